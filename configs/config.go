@@ -3,6 +3,7 @@
 package configs
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/aidoc/go-aidoc/lib/chain_common"
@@ -81,9 +82,15 @@ var (
 		//big.NewInt(0),
 		//big.NewInt(0) ,
 		big.NewInt(0),
+		big.NewInt(0),
+		big.NewInt(0),
+		big.NewInt(0),
+		big.NewInt(0),
 		//nil,
 		new(AidochashConfig),
 		//nil,
+		nil,
+		nil,
 	}
 
 		// AllCliqueProtocolChanges包含由Aidoc核心开发人员引入和接受的每个协议更改（EIP）到Clique共识中。
@@ -101,9 +108,15 @@ var (
 		//big.NewInt(0),
 		//big.NewInt(0) ,
 		big.NewInt(0),
+		big.NewInt(0),
+		big.NewInt(0),
+		big.NewInt(0),
+		big.NewInt(0),
 		//nil,
 		nil,
 		//&CliqueConfig{Period: 0, Epoch: 30000}
+		nil,
+		nil,
 	}
 
 	TestChainConfig = &ChainConfig{
@@ -117,9 +130,15 @@ var (
 		//big.NewInt(0),
 		//big.NewInt(0) ,
 		big.NewInt(0),
+		nil,
+		nil,
+		nil,
+		nil,
 		//nil,
 		new(AidochashConfig),
 		//nil
+		nil,
+		nil,
 	}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
@@ -147,12 +166,107 @@ type ChainConfig struct {
 
 	AiDocBlock *big.Int `json:"aiDocBlock,omitempty"` //aidoc HF block
 
+	ReceiptRootBlock *big.Int `json:"receiptRootBlock,omitempty"` // 收据携带交易后中间状态根的开关块（nil = 收据只记录状态码）
+	AccessListBlock  *big.Int `json:"accessListBlock,omitempty"`  // 类型化交易和访问列表的开关块（nil = 只接受旧式交易）
+	DynamicFeeBlock  *big.Int `json:"dynamicFeeBlock,omitempty"`  // 区块基础费用和费用上限/小费交易的开关块（nil = 只使用单一gas价格）
+	FeePayerBlock    *big.Int `json:"feePayerBlock,omitempty"`    // 代付gas交易的开关块（nil = gas 总是由发送者支付）
+
 	//ByzantiumBlock      *big.Int `json:"byzantiumBlock,omitempty"`      //  拜占庭开关块（nil =无叉，0 =已经在拜占庭）
 	//ConstantinopleBlock *big.Int `json:"constantinopleBlock,omitempty"` // 君士坦丁堡开关块（nil =无叉，0 =已激活）
 
 	//  各种共识引擎
 	Aidochash *AidochashConfig `json:"aidochash,omitempty"`
 	//Clique *CliqueConfig `json:"clique,omitempty"`
+
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"` // 可信的区块头检查点
+
+	Reward *RewardConfig `json:"reward,omitempty"` // 链级区块奖励和交易费分配规则（nil = 交易费全部归 coinbase）
+}
+
+// Checkpoint 是一个可信的（编号，哈希）对。 该高度上哈希不同的区块头会被拒绝，
+// 并且本地链不允许回卷到最新的检查点以下。
+type Checkpoint struct {
+	Number uint64            `json:"number"`
+	Hash   chain_common.Hash `json:"hash"`
+}
+
+// 访问列表中每一项需要预先支付的 gas。
+const (
+	TxAccessListAddressGas    uint64 = 2400 // 访问列表中每个账户的 gas
+	TxAccessListStorageKeyGas uint64 = 1900 // 访问列表中每个存储槽的 gas
+)
+
+// 区块基础费用的调整参数。
+const (
+	BaseFeeChangeDenominator = 8          // 基础费用每个区块最多变化 1/BaseFeeChangeDenominator
+	ElasticityMultiplier     = 2          // 区块 gas 限制与目标 gas 使用量之比
+	InitialBaseFee           = 1000000000 // DynamicFeeBlock 区块的基础费用
+)
+
+// RewardShareDenominator 是 RewardConfig 中交易费分配比例的分母，即比例以万分比表示。
+const RewardShareDenominator = 10000
+
+// RewardConfig 描述区块奖励的发行计划以及交易费在 coinbase、国库和销毁之间的分配。
+//
+// 交易费中国库和销毁份额以外的部分归 coinbase。 已经生效的阶段和比例不能修改，否则会改变历史区块的状态。
+type RewardConfig struct {
+	Schedule      []RewardEra          `json:"schedule,omitempty"`      // 按起始高度升序排列的发行阶段
+	Treasury      chain_common.Address `json:"treasury"`                // 接收交易费分成的国库地址
+	TreasuryShare uint64               `json:"treasuryShare,omitempty"` // 交易费分给国库的比例（万分比）
+	BurnShare     uint64               `json:"burnShare,omitempty"`     // 交易费销毁的比例（万分比）
+}
+
+// RewardEra 是发行计划中的一个阶段，从 Block 开始直到下一个阶段开始，每个区块向 coinbase 发行 Reward。
+type RewardEra struct {
+	Block  *big.Int `json:"block"`
+	Reward *big.Int `json:"reward"`
+}
+
+// Validate 检查发行阶段是否按起始高度严格升序排列、奖励是否非负，以及分配比例之和是否超过 100%。
+func (c *RewardConfig) Validate() error {
+	for i, era := range c.Schedule {
+		if era.Block == nil || era.Reward == nil {
+			return fmt.Errorf(i18.I18_print.Sprintf("奖励阶段 %d 缺少起始高度或奖励", i))
+		}
+		if era.Reward.Sign() < 0 {
+			return fmt.Errorf(i18.I18_print.Sprintf("奖励阶段 %d 的奖励为负数: %v", i, era.Reward))
+		}
+		if i > 0 && era.Block.Cmp(c.Schedule[i-1].Block) <= 0 {
+			return fmt.Errorf(i18.I18_print.Sprintf("奖励阶段 %d 的起始高度 %v 不大于上一阶段的 %v", i, era.Block, c.Schedule[i-1].Block))
+		}
+	}
+	if c.TreasuryShare+c.BurnShare > RewardShareDenominator {
+		return fmt.Errorf(i18.I18_print.Sprintf("交易费分配比例之和超过 %d: 国库 %d, 销毁 %d", RewardShareDenominator, c.TreasuryShare, c.BurnShare))
+	}
+	return nil
+}
+
+// BlockReward 返回高度 num 的区块向 coinbase 发行的奖励。 第一个阶段开始之前的区块没有奖励。
+func (c *RewardConfig) BlockReward(num *big.Int) *big.Int {
+	reward := new(big.Int)
+	for _, era := range c.Schedule {
+		if !isForked(era.Block, num) {
+			break
+		}
+		reward.Set(era.Reward)
+	}
+	return reward
+}
+
+// SplitFees 将区块的交易费总额分为 coinbase、国库和销毁三部分，舍入的余数归 coinbase。
+func (c *RewardConfig) SplitFees(fees *big.Int) (coinbase, treasury, burnt *big.Int) {
+	denominator := big.NewInt(RewardShareDenominator)
+
+	treasury = new(big.Int).Mul(fees, new(big.Int).SetUint64(c.TreasuryShare))
+	treasury.Div(treasury, denominator)
+
+	burnt = new(big.Int).Mul(fees, new(big.Int).SetUint64(c.BurnShare))
+	burnt.Div(burnt, denominator)
+
+	coinbase = new(big.Int).Sub(fees, treasury)
+	coinbase.Sub(coinbase, burnt)
+
+	return coinbase, treasury, burnt
 }
 
 // AidochashConfig 是基于工作量证明的密封的共识发动机配置。
@@ -236,11 +350,52 @@ func( c *ChainConfig) IsAiDoc( num *big.Int) bool{
 	return isForked(c.AiDocBlock , num)
 }
 
+// IsReceiptRoot 返回 num 是否等于 ReceiptRootBlock 或更大，即收据是否携带中间状态根。
+func (c *ChainConfig) IsReceiptRoot(num *big.Int) bool {
+	return isForked(c.ReceiptRootBlock, num)
+}
+
+// IsAccessList 返回 num 是否等于 AccessListBlock 或更大，即是否接受带访问列表的类型化交易。
+func (c *ChainConfig) IsAccessList(num *big.Int) bool {
+	return isForked(c.AccessListBlock, num)
+}
+
+// IsDynamicFee 返回 num 是否等于 DynamicFeeBlock 或更大，即区块是否有基础费用并接受费用上限/小费交易。
+func (c *ChainConfig) IsDynamicFee(num *big.Int) bool {
+	return isForked(c.DynamicFeeBlock, num)
+}
+
+// IsFeePayer 返回 num 是否等于 FeePayerBlock 或更大，即是否接受由第三方代付gas的交易。
+func (c *ChainConfig) IsFeePayer(num *big.Int) bool {
+	return isForked(c.FeePayerBlock, num)
+}
+
 //// IsConstantinople 返回 num 是否等于 Constantinople fork 块或更大。
 //func (c *ChainConfig) IsConstantinople(num *big.Int) bool {
 //	return isForked(c.ConstantinopleBlock, num)
 //}
 
+// CheckpointHash 返回给定高度上配置的检查点哈希，以及该高度是否存在检查点。
+func (c *ChainConfig) CheckpointHash(number uint64) (chain_common.Hash, bool) {
+	for _, cp := range c.Checkpoints {
+		if cp.Number == number {
+			return cp.Hash, true
+		}
+	}
+	return chain_common.Hash{}, false
+}
+
+// LatestCheckpoint 返回编号不超过 head 的最高检查点，如果没有则返回 nil。
+func (c *ChainConfig) LatestCheckpoint(head uint64) *Checkpoint {
+	var latest *Checkpoint
+	for i := range c.Checkpoints {
+		if cp := &c.Checkpoints[i]; cp.Number <= head && (latest == nil || cp.Number > latest.Number) {
+			latest = cp
+		}
+	}
+	return latest
+}
+
 // GasTable 返回与当前阶段（Homestead 或 Homestead 重新定价）相对应的gas表。
 //
 // 在任何情况下都不应更改返回的 GasTable 字段。
@@ -258,6 +413,14 @@ func (c *ChainConfig) GasTable(num *big.Int) GasTable {
 	//}
 	return GasTableHomestead
 }
+// Validate 检查链配置自身是否一致，目前检查奖励计划。 使用配置打开链之前必须调用它。
+func (c *ChainConfig) Validate() error {
+	if c.Reward != nil {
+		return c.Reward.Validate()
+	}
+	return nil
+}
+
 // CheckCompatible 检查是否使用不匹配的链配置导入了调度的fork转换。
 func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
 	bhead := new(big.Int).SetUint64(height)
@@ -279,6 +442,18 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.HomesteadBlock, newcfg.HomesteadBlock, head) {
 		return newCompatError("HomesteadBlock", c.HomesteadBlock, newcfg.HomesteadBlock)
 	}
+	if isForkIncompatible(c.ReceiptRootBlock, newcfg.ReceiptRootBlock, head) {
+		return newCompatError("ReceiptRootBlock", c.ReceiptRootBlock, newcfg.ReceiptRootBlock)
+	}
+	if isForkIncompatible(c.AccessListBlock, newcfg.AccessListBlock, head) {
+		return newCompatError("AccessListBlock", c.AccessListBlock, newcfg.AccessListBlock)
+	}
+	if isForkIncompatible(c.DynamicFeeBlock, newcfg.DynamicFeeBlock, head) {
+		return newCompatError("DynamicFeeBlock", c.DynamicFeeBlock, newcfg.DynamicFeeBlock)
+	}
+	if isForkIncompatible(c.FeePayerBlock, newcfg.FeePayerBlock, head) {
+		return newCompatError("FeePayerBlock", c.FeePayerBlock, newcfg.FeePayerBlock)
+	}
 	//if isForkIncompatible(c.DAOForkBlock, newcfg.DAOForkBlock, head) {
 	//	return newCompatError("DAO叉块", c.DAOForkBlock, newcfg.DAOForkBlock)
 	//}
@@ -6,6 +6,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -56,6 +58,50 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     9,
 			},
 		},
+		{
+			stored: &ChainConfig{ReceiptRootBlock: big.NewInt(10)},
+			new:    &ChainConfig{ReceiptRootBlock: big.NewInt(20)},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "ReceiptRootBlock",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{AccessListBlock: nil},
+			new:    &ChainConfig{AccessListBlock: big.NewInt(5)},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "AccessListBlock",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(5),
+				RewindTo:     4,
+			},
+		},
+		{
+			stored: &ChainConfig{DynamicFeeBlock: big.NewInt(30)},
+			new:    &ChainConfig{DynamicFeeBlock: nil},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "DynamicFeeBlock",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    nil,
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{FeePayerBlock: big.NewInt(10)},
+			new:    &ChainConfig{FeePayerBlock: big.NewInt(12)},
+			head:   11,
+			wantErr: &ConfigCompatError{
+				What:         "FeePayerBlock",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(12),
+				RewindTo:     9,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -65,3 +111,137 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestProtocolChangesEnableForks(t *testing.T) {
+	configs := map[string]*ChainConfig{
+		"AllAidochashProtocolChanges": AllAidochashProtocolChanges,
+		"AllCliqueProtocolChanges":    AllCliqueProtocolChanges,
+	}
+	for name, config := range configs {
+		forks := map[string]func(*big.Int) bool{
+			"ReceiptRootBlock": config.IsReceiptRoot,
+			"AccessListBlock":  config.IsAccessList,
+			"DynamicFeeBlock":  config.IsDynamicFee,
+			"FeePayerBlock":    config.IsFeePayer,
+		}
+		for fork, enabled := range forks {
+			if !enabled(new(big.Int)) {
+				t.Errorf("%s: 创世块未启用 %s", name, fork)
+			}
+		}
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	config := &ChainConfig{
+		Checkpoints: []Checkpoint{
+			{Number: 100, Hash: chain_common.HexToHash("0x01")},
+			{Number: 300, Hash: chain_common.HexToHash("0x03")},
+			{Number: 200, Hash: chain_common.HexToHash("0x02")},
+		},
+	}
+	if hash, ok := config.CheckpointHash(200); !ok || hash != chain_common.HexToHash("0x02") {
+		t.Errorf("检查点哈希不匹配: 得到 %x (%v), 需要 %x", hash, ok, chain_common.HexToHash("0x02"))
+	}
+	if _, ok := config.CheckpointHash(150); ok {
+		t.Errorf("高度 150 不应存在检查点")
+	}
+	tests := []struct {
+		head uint64
+		want uint64 // 0 表示没有检查点
+	}{
+		{head: 0, want: 0},
+		{head: 99, want: 0},
+		{head: 100, want: 100},
+		{head: 250, want: 200},
+		{head: 1000, want: 300},
+	}
+	for _, test := range tests {
+		var got uint64
+		if cp := config.LatestCheckpoint(test.head); cp != nil {
+			got = cp.Number
+		}
+		if got != test.want {
+			t.Errorf("头 %d: 最新检查点不匹配: 得到 %d, 需要 %d", test.head, got, test.want)
+		}
+	}
+}
+
+func TestRewardSchedule(t *testing.T) {
+	config := &RewardConfig{
+		Schedule: []RewardEra{
+			{Block: big.NewInt(10), Reward: big.NewInt(5000)},
+			{Block: big.NewInt(100), Reward: big.NewInt(2500)},
+			{Block: big.NewInt(1000), Reward: big.NewInt(0)},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("有效的奖励配置校验失败: %v", err)
+	}
+	tests := []struct {
+		number int64
+		want   int64
+	}{
+		{0, 0},
+		{9, 0},
+		{10, 5000},
+		{99, 5000},
+		{100, 2500},
+		{999, 2500},
+		{1000, 0},
+		{5000, 0},
+	}
+	for _, test := range tests {
+		if got := config.BlockReward(big.NewInt(test.number)); got.Cmp(big.NewInt(test.want)) != 0 {
+			t.Errorf("区块 %d: 奖励不匹配: 得到 %v, 需要 %d", test.number, got, test.want)
+		}
+	}
+}
+
+func TestRewardSplitFees(t *testing.T) {
+	tests := []struct {
+		treasuryShare, burnShare uint64
+		fees                     int64
+		coinbase, treasury, burn int64
+	}{
+		// 没有分成时全部归 coinbase
+		{0, 0, 1000, 1000, 0, 0},
+		// 国库分成
+		{2500, 0, 1000, 750, 250, 0},
+		// 销毁
+		{0, 5000, 1000, 500, 0, 500},
+		// 国库分成和销毁同时生效
+		{1000, 2000, 1000, 700, 100, 200},
+		// 全部销毁
+		{0, RewardShareDenominator, 1000, 0, 0, 1000},
+		// 舍入的余数归 coinbase
+		{3333, 3333, 10, 6, 3, 3},
+	}
+	for i, test := range tests {
+		config := &RewardConfig{TreasuryShare: test.treasuryShare, BurnShare: test.burnShare}
+		coinbase, treasury, burnt := config.SplitFees(big.NewInt(test.fees))
+		if coinbase.Int64() != test.coinbase || treasury.Int64() != test.treasury || burnt.Int64() != test.burn {
+			t.Errorf("测试 %d: 分配不匹配: 得到 (%v, %v, %v), 需要 (%d, %d, %d)", i, coinbase, treasury, burnt, test.coinbase, test.treasury, test.burn)
+		}
+	}
+}
+
+func TestRewardValidate(t *testing.T) {
+	tests := []*RewardConfig{
+		{TreasuryShare: 6000, BurnShare: 5000},
+		{Schedule: []RewardEra{{Block: big.NewInt(10), Reward: big.NewInt(1)}, {Block: big.NewInt(10), Reward: big.NewInt(2)}}},
+		{Schedule: []RewardEra{{Block: big.NewInt(10), Reward: big.NewInt(-1)}}},
+		{Schedule: []RewardEra{{Block: big.NewInt(10)}}},
+	}
+	for i, config := range tests {
+		if err := config.Validate(); err == nil {
+			t.Errorf("测试 %d: 无效的奖励配置通过了校验", i)
+		}
+		if err := (&ChainConfig{Reward: config}).Validate(); err == nil {
+			t.Errorf("测试 %d: 包含无效奖励配置的链配置通过了校验", i)
+		}
+	}
+	if err := TestChainConfig.Validate(); err != nil {
+		t.Errorf("没有奖励配置的链配置校验失败: %v", err)
+	}
+}
@@ -1,5 +1,10 @@
 package configs
 
+import (
+	"math/big"
+	"strings"
+)
+
 //这些是 Aidoc 面额的乘数。
 //示例：要获取“LiShizhen”中金额的 Dose 值，请使用
 //
@@ -15,3 +20,65 @@ const (
     SunSimiao       = 1e21
     LiShizhen       = 1e42
 )
+
+// Denomination 是一个带名称的 Aidoc 面额，Multiplier 是一个单位等于多少 Dose。
+type Denomination struct {
+	Name       string
+	Multiplier *big.Int
+}
+
+// Denominations 按从小到大的顺序列出所有 Aidoc 面额。
+var Denominations = []Denomination{
+	{"Dose", big.NewInt(Dose)},
+	{"BianQue", big.NewInt(BianQue)},
+	{"HuaTuo", big.NewInt(HuaTuo)},
+	{"ZhangZhongjing", big.NewInt(ZhangZhongjing)},
+	{"HuangFumi", big.NewInt(HuangFumi)},
+	{"Songci", big.NewInt(Songci)},
+	{"Aidoc", big.NewInt(Aidoc)},
+	{"SunSimiao", new(big.Int).Exp(big.NewInt(10), big.NewInt(21), nil)},
+	{"LiShizhen", new(big.Int).Exp(big.NewInt(10), big.NewInt(42), nil)},
+}
+
+// FormatAmount 以不大于金额的最大面额显示以 Dose 为单位的金额，小数部分去掉末尾的 0，
+// 例如 1500000000000000000 显示为 "1.5 Aidoc"。 nil 和 0 显示为 "0 Dose"。
+func FormatAmount(amount *big.Int) string {
+	if amount == nil || amount.Sign() == 0 {
+		return "0 " + Denominations[0].Name
+	}
+	abs := new(big.Int).Abs(amount)
+
+	unit := Denominations[0]
+	for _, denom := range Denominations[1:] {
+		if abs.Cmp(denom.Multiplier) < 0 {
+			break
+		}
+		unit = denom
+	}
+	return FormatAmountIn(amount, unit)
+}
+
+// FormatAmountIn 以给定面额显示以 Dose 为单位的金额，小数部分去掉末尾的 0。
+func FormatAmountIn(amount *big.Int, unit Denomination) string {
+	if amount == nil {
+		amount = new(big.Int)
+	}
+	quo, rem := new(big.Int).QuoRem(new(big.Int).Abs(amount), unit.Multiplier, new(big.Int))
+
+	var b strings.Builder
+	if amount.Sign() < 0 {
+		b.WriteByte('-')
+	}
+	b.WriteString(quo.String())
+	if rem.Sign() > 0 {
+		// 小数位数等于乘数的位数减一
+		digits := len(unit.Multiplier.String()) - 1
+		frac := rem.String()
+		frac = strings.Repeat("0", digits-len(frac)) + frac
+		b.WriteByte('.')
+		b.WriteString(strings.TrimRight(frac, "0"))
+	}
+	b.WriteByte(' ')
+	b.WriteString(unit.Name)
+	return b.String()
+}
@@ -0,0 +1,30 @@
+package configs
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFormatAmount(t *testing.T) {
+	aidoc := big.NewInt(Aidoc)
+	tests := []struct {
+		amount *big.Int
+		want   string
+	}{
+		{nil, "0 Dose"},
+		{big.NewInt(0), "0 Dose"},
+		{big.NewInt(999), "999 Dose"},
+		{big.NewInt(1000), "1 BianQue"},
+		{big.NewInt(1500), "1.5 BianQue"},
+		{big.NewInt(21000 * ZhangZhongjing), "21 HuangFumi"},
+		{new(big.Int).Mul(big.NewInt(15), big.NewInt(Aidoc/10)), "1.5 Aidoc"},
+		{new(big.Int).Add(aidoc, big.NewInt(1)), "1.000000000000000001 Aidoc"},
+		{new(big.Int).Neg(aidoc), "-1 Aidoc"},
+		{new(big.Int).Mul(aidoc, big.NewInt(2500)), "2.5 SunSimiao"},
+	}
+	for _, test := range tests {
+		if got := FormatAmount(test.amount); got != test.want {
+			t.Errorf("FormatAmount(%v) = %q, 需要 %q", test.amount, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package chain_core
+
+import (
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+)
+
+// CalcBaseFee 根据父区块头及其基础费用计算子区块的基础费用。
+//
+// 目标gas使用量是父区块gas限制的 1/ElasticityMultiplier。 父区块使用的gas高于目标时基础费用上升
+// （至少上升 1），低于目标时下降，每个区块最多变化 1/BaseFeeChangeDenominator。
+func CalcBaseFee(parent *types.Header, parentBaseFee *big.Int) *big.Int {
+	target := parent.GasLimit / configs.ElasticityMultiplier
+	if target == 0 || parent.GasUsed == target {
+		return new(big.Int).Set(parentBaseFee)
+	}
+	var (
+		targetBig   = new(big.Int).SetUint64(target)
+		denominator = big.NewInt(configs.BaseFeeChangeDenominator)
+	)
+	if parent.GasUsed > target {
+		delta := new(big.Int).SetUint64(parent.GasUsed - target)
+		delta.Mul(delta, parentBaseFee)
+		delta.Div(delta, targetBig)
+		delta.Div(delta, denominator)
+		if delta.Sign() == 0 {
+			delta.SetInt64(1)
+		}
+		return delta.Add(delta, parentBaseFee)
+	}
+	delta := new(big.Int).SetUint64(target - parent.GasUsed)
+	delta.Mul(delta, parentBaseFee)
+	delta.Div(delta, targetBig)
+	delta.Div(delta, denominator)
+
+	baseFee := delta.Sub(parentBaseFee, delta)
+	if baseFee.Sign() < 0 {
+		baseFee.SetInt64(0)
+	}
+	return baseFee
+}
+
+// BaseFee 返回区块头对应区块的基础费用，动态费用分叉之前返回 nil。 区块头本身不必已经写入数据库，
+// 但它的祖先必须可以找到，否则返回 nil。
+func (hc *HeaderChain) BaseFee(header *types.Header) *big.Int {
+	return baseFeeAt(hc.config, header, hc.GetHeader, hc.baseFeeCache)
+}
+
+// BaseFee 返回区块头对应区块的基础费用，动态费用分叉之前返回 nil。 结果由区块头链缓存。
+func (bc *BlockChain) BaseFee(header *types.Header) *big.Int {
+	return bc.hc.BaseFee(header)
+}
+
+// baseFeeReader 由可以提供缓存的基础费用的链实现，例如 HeaderChain 和 BlockChain。
+type baseFeeReader interface {
+	BaseFee(header *types.Header) *big.Int
+}
+
+// headerReader 是沿祖先计算基础费用所需的链访问方法，ChainContext 和 consensus.ChainReader 都实现了它。
+type headerReader interface {
+	GetHeader(hash chain_common.Hash, number uint64) *types.Header
+}
+
+// chainBaseFee 返回区块的基础费用。 链实现了 baseFeeReader 时使用其缓存，否则沿祖先重新计算。
+func chainBaseFee(config *configs.ChainConfig, chain headerReader, header *types.Header) *big.Int {
+	if reader, ok := chain.(baseFeeReader); ok {
+		return reader.BaseFee(header)
+	}
+	return baseFeeAt(config, header, chain.GetHeader, nil)
+}
+
+// baseFeeAt 计算区块的基础费用。 基础费用不保存在区块头中，而是从动态费用分叉区块的 InitialBaseFee
+// 开始，由每个父区块的gas使用量逐块推导。 它沿父区块回溯到分叉区块或缓存中已有基础费用的区块，
+// 再向前计算并缓存沿途每个区块的结果。 cache 可以为 nil。
+func baseFeeAt(config *configs.ChainConfig, header *types.Header, getHeader func(chain_common.Hash, uint64) *types.Header, cache *meteredCache) *big.Int {
+	if !config.IsDynamicFee(header.Number) {
+		return nil
+	}
+	var (
+		fee     *big.Int
+		parent  *types.Header
+		pending []*types.Header // 需要计算基础费用的区块，从新到旧
+	)
+	for h := header; ; {
+		if cache != nil {
+			if cached, ok := cache.Get(h.Hash()); ok {
+				fee, parent = cached.(*big.Int), h
+				break
+			}
+		}
+		pending = append(pending, h)
+		if h.Number.Cmp(config.DynamicFeeBlock) <= 0 {
+			break
+		}
+		if h = getHeader(h.ParentHash, h.Number.Uint64()-1); h == nil {
+			return nil
+		}
+	}
+	for i := len(pending) - 1; i >= 0; i-- {
+		if parent == nil {
+			fee = big.NewInt(configs.InitialBaseFee)
+		} else {
+			fee = CalcBaseFee(parent, fee)
+		}
+		parent = pending[i]
+		if cache != nil {
+			cache.Add(parent.Hash(), fee)
+		}
+	}
+	return new(big.Int).Set(fee)
+}
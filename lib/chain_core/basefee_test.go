@@ -0,0 +1,117 @@
+package chain_core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/state"
+	"github.com/aidoc/go-aidoc/service/db_model"
+)
+
+func TestCalcBaseFee(t *testing.T) {
+	tests := []struct {
+		gasLimit uint64
+		gasUsed  uint64
+		baseFee  int64
+		want     int64
+	}{
+		{1000000, 500000, 1000, 1000},  // 等于目标，不变
+		{1000000, 1000000, 1000, 1125}, // 区块满，上升 1/8
+		{1000000, 750000, 1000, 1062},  // 高于目标
+		{1000000, 0, 1000, 875},        // 空区块，下降 1/8
+		{1000000, 250000, 1000, 938},   // 低于目标
+		{1000000, 500001, 7, 8},        // 上升幅度不足 1 时至少上升 1
+		{1, 1, 1000, 1000},             // 目标为零，不变
+	}
+	for i, test := range tests {
+		parent := &types.Header{Number: big.NewInt(1), GasLimit: test.gasLimit, GasUsed: test.gasUsed}
+		if have := CalcBaseFee(parent, big.NewInt(test.baseFee)); have.Int64() != test.want {
+			t.Errorf("测试 %d: 基础费用不匹配: 得到 %d, 需要 %d", i, have, test.want)
+		}
+	}
+}
+
+func TestApplyTransactionBurnsBaseFee(t *testing.T) {
+	var (
+		config   = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), DynamicFeeBlock: big.NewInt(0)}
+		signer   = types.MakeTypedSigner(config, big.NewInt(1))
+		coinbase = chain_common.Address{0xaa}
+		to       = chain_common.Address{0x01}
+		baseFee  = big.NewInt(10)
+		key, _   = crypto.GenerateKey()
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	sign := func(tx *types.Transaction) *types.Transaction {
+		signed, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		return signed
+	}
+	txs := types.Transactions{
+		// 实际价格 min(20, 10+2) = 12，小费 2
+		sign(types.NewDynamicFeeTransaction(config.ChainID, 0, &to, big.NewInt(1), 21000, big.NewInt(2), big.NewInt(20), nil, nil)),
+		// 旧式交易的gas价格同时作为费用上限和小费上限，小费 15-10 = 5
+		sign(types.NewTransaction(1, to, big.NewInt(1), 21000, big.NewInt(15), nil)),
+	}
+	block := types.NewBlockWithHeader(&types.Header{
+		Number:   big.NewInt(1),
+		GasLimit: 8000000,
+		Coinbase: coinbase,
+	}).WithBody(txs, nil)
+
+	statedb, err := state.New(chain_common.Hash{}, state.NewDatabase(db_model.NewMemDatabase()))
+	if err != nil {
+		t.Fatalf("无法创建状态: %v", err)
+	}
+	statedb.AddBalance(sender, big.NewInt(1000000000))
+
+	p := &StateProcessor{config: config}
+	chain := &testChainContext{engine: &testEngine{}}
+	if _, _, err := p.processSerial(block, chain, statedb, new(GasPool).AddGas(block.GasLimit()), baseFee, new(uint64), vm.Config{}); err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	// coinbase 只保留小费，基础费用部分被销毁
+	if have, want := statedb.GetBalance(coinbase), big.NewInt(21000*2+21000*5); have.Cmp(want) != 0 {
+		t.Errorf("coinbase 余额不匹配: 得到 %v, 需要 %v", have, want)
+	}
+	if have, want := statedb.GetBalance(sender), big.NewInt(1000000000-2-21000*12-21000*15); have.Cmp(want) != 0 {
+		t.Errorf("发送者余额不匹配: 得到 %v, 需要 %v", have, want)
+	}
+	// 费用上限低于基础费用的交易不能执行
+	low := sign(types.NewDynamicFeeTransaction(config.ChainID, 2, &to, big.NewInt(1), 21000, big.NewInt(1), big.NewInt(9), nil, nil))
+	_, _, err = applyTransaction(config, chain, nil, new(GasPool).AddGas(block.GasLimit()), statedb, statedb, block.Header(), low, baseFee, new(uint64), vm.Config{})
+	if !errors.Is(err, ErrFeeCapTooLow) {
+		t.Errorf("费用上限过低: 得到 %v, 需要 %v", err, ErrFeeCapTooLow)
+	}
+}
+
+func TestPricedListBaseFee(t *testing.T) {
+	var (
+		to      = chain_common.Address{0x01}
+		legacy  = types.NewTransaction(0, to, big.NewInt(0), 21000, big.NewInt(20), nil)
+		dynamic = types.NewDynamicFeeTransaction(big.NewInt(1), 0, &to, big.NewInt(0), 21000, big.NewInt(5), big.NewInt(100), nil, nil)
+	)
+	priced := newTxPricedList()
+	priced.Put(legacy)
+	priced.Put(dynamic)
+
+	// 基础费用未知时按小费上限（旧式交易即gas价格）排序
+	if cheapest := priced.items.txs[0]; cheapest != dynamic {
+		t.Errorf("没有基础费用时最便宜的交易不匹配: 得到 %x, 需要 %x", cheapest.Hash(), dynamic.Hash())
+	}
+	// 基础费用 18 之后旧式交易的实际小费只有 2，低于动态费用交易的 5
+	priced.SetBaseFee(big.NewInt(18))
+	if cheapest := priced.items.txs[0]; cheapest != legacy {
+		t.Errorf("基础费用 18 时最便宜的交易不匹配: 得到 %x, 需要 %x", cheapest.Hash(), legacy.Hash())
+	}
+	if !priced.Underpriced(types.NewTransaction(1, to, big.NewInt(0), 21000, big.NewInt(19), nil), newAccountSet(types.HomesteadSigner{})) {
+		t.Errorf("实际小费为 1 的交易应该定价过低")
+	}
+}
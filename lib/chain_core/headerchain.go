@@ -7,25 +7,137 @@ import (
 	"math"
 	"math/big"
 	mrand "math/rand"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/aidoc/go-aidoc/lib/chain_common"
 	"github.com/aidoc/go-aidoc/lib/rawdb"
 	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/event"
 	"github.com/aidoc/go-aidoc/service/db_model"
 	"github.com/aidoc/go-aidoc/lib/logger"
 	"github.com/aidoc/go-aidoc/configs"
 	"github.com/hashicorp/golang-lru"
 	"github.com/aidoc/go-aidoc/service/produce/consensus"
 	"github.com/aidoc/go-aidoc/lib/i18"
+	"github.com/aidoc/go-aidoc/service/metrics"
 )
 
 const (
-	headerCacheLimit = 512
-	tdCacheLimit     = 1024
-	numberCacheLimit = 2048
+	headerCacheLimit  = 512
+	tdCacheLimit      = 1024
+	numberCacheLimit  = 2048
+	baseFeeCacheLimit = 1024
+	reorgQueueLimit   = 256 // 等待发送的重组事件上限，超出时丢弃最早的事件
 )
+
+var (
+	headerCacheHitCounter   = metrics.NewRegisteredCounter("chain/headers/cache/hit", nil)
+	headerCacheMissCounter  = metrics.NewRegisteredCounter("chain/headers/cache/miss", nil)
+	tdCacheHitCounter       = metrics.NewRegisteredCounter("chain/td/cache/hit", nil)
+	tdCacheMissCounter      = metrics.NewRegisteredCounter("chain/td/cache/miss", nil)
+	numberCacheHitCounter   = metrics.NewRegisteredCounter("chain/number/cache/hit", nil)
+	numberCacheMissCounter  = metrics.NewRegisteredCounter("chain/number/cache/miss", nil)
+	baseFeeCacheHitCounter  = metrics.NewRegisteredCounter("chain/basefee/cache/hit", nil)
+	baseFeeCacheMissCounter = metrics.NewRegisteredCounter("chain/basefee/cache/miss", nil)
+	reorgDroppedCounter     = metrics.NewRegisteredCounter("chain/reorg/dropped", nil)
+)
+
+// HeaderCacheConfig 包含 HeaderChain 内部 LRU 缓存的容量，由节点配置提供。 为零的字段使用默认容量。
+type HeaderCacheConfig struct {
+	HeaderCache  int // 缓存的区块头数量
+	TdCache      int // 缓存的区块总难度数量
+	NumberCache  int // 缓存的哈希到编号映射数量
+	BaseFeeCache int // 缓存的区块基础费用数量
+}
+
+// meteredCache 是一个统计 Get 命中和未命中次数的 LRU 缓存。
+type meteredCache struct {
+	*lru.Cache
+	hits, misses metrics.Counter
+}
+
+// newMeteredCache 创建一个给定容量的计量缓存，size 不为正数时使用 fallback。
+func newMeteredCache(size, fallback int, hits, misses metrics.Counter) *meteredCache {
+	if size <= 0 {
+		size = fallback
+	}
+	cache, _ := lru.New(size)
+	return &meteredCache{Cache: cache, hits: hits, misses: misses}
+}
+
+// Get 从缓存中查找键值并更新命中计数器。
+func (c *meteredCache) Get(key interface{}) (interface{}, bool) {
+	value, ok := c.Cache.Get(key)
+	if ok {
+		c.hits.Inc(1)
+	} else {
+		c.misses.Inc(1)
+	}
+	return value, ok
+}
+
+var (
+	// ErrInvalidParent 在区块的父哈希与本地父区块头不一致时返回。
+	ErrInvalidParent = errors.New("无效的父区块哈希")
+
+	// ErrInvalidBlockNumber 在区块编号不是父区块编号加一时返回。
+	ErrInvalidBlockNumber = errors.New("无效的区块编号")
+
+	// ErrInvalidTimestamp 在区块时间戳不晚于父区块时间戳时返回。
+	ErrInvalidTimestamp = errors.New("区块时间戳早于或等于父区块")
+
+	// ErrInvalidGasLimit 在区块 gas 限制超出允许的调整范围时返回。
+	ErrInvalidGasLimit = errors.New("无效的 gas 限制")
+
+	// ErrInvalidGasUsed 在区块使用的 gas 超过其 gas 限制时返回。
+	ErrInvalidGasUsed = errors.New("使用的 gas 超过 gas 限制")
+
+	// ErrExtraDataTooLong 在区块额外数据超过协议上限时返回。
+	ErrExtraDataTooLong = errors.New("额外数据过长")
+
+	// ErrInvalidSeal 在共识引擎拒绝区块密封时返回。
+	ErrInvalidSeal = errors.New("无效的区块密封")
+
+	// ErrInvalidGenesis 在编号为 0 的区块与本地创世区块不一致时返回。
+	ErrInvalidGenesis = errors.New("区块与本地创世区块不一致")
+
+	// ErrInvalidTxRoot 在区块体中的交易与区块头的交易根不一致时返回。
+	ErrInvalidTxRoot = errors.New("交易根与区块体不一致")
+
+	// ErrInvalidUncleHash 在区块体中的叔块与区块头的叔块哈希不一致时返回。
+	ErrInvalidUncleHash = errors.New("叔块哈希与区块体不一致")
+
+	// ErrNotCanonical 在一个声称已确认的区块不在本地规范链上时返回。
+	ErrNotCanonical = errors.New("区块不在规范链上")
+
+	// ErrCheckpointMismatch 在区块头的哈希与链配置中同一高度的检查点不一致时返回。
+	ErrCheckpointMismatch = errors.New("区块头与检查点不一致")
+
+	// ErrRewindBelowCheckpoint 在 TrySetHead 试图将链回卷到最新检查点以下时返回。
+	ErrRewindBelowCheckpoint = errors.New("不能回卷到检查点以下")
+
+	// ErrUntrustedHeader 在 StartFromCheckpoint 收到的区块头不是链配置中的检查点时返回。
+	ErrUntrustedHeader = errors.New("区块头不是配置的检查点")
+)
+
+// BlockVerifyError 描述了区块校验失败的具体区块和原因。 同步代码可以通过 Err 字段
+// 与上面定义的错误比较，以决定是丢弃区块、惩罚节点还是稍后重试。
+type BlockVerifyError struct {
+	Number uint64            // 校验失败的区块编号
+	Hash   chain_common.Hash // 校验失败的区块哈希
+	Err    error             // 失败原因
+}
+
+func (e *BlockVerifyError) Error() string {
+	return i18.I18_print.Sprintf("区块 #%d [%x…] 校验失败: %v", e.Number, e.Hash.Bytes()[:4], e.Err)
+}
+
+// Unwrap 返回失败原因，使调用方可以使用 errors.Is 判断错误类型。
+func (e *BlockVerifyError) Unwrap() error {
+	return e.Err
+}
 // HeaderChain实现了core.BlockChain和light.LightChain共享的基本块头链逻辑。 它本身不可用，
 // 只作为任一结构的一部分。 它也不是线程安全的，封装链结构应该进行必要的互斥锁定/解锁。
 type HeaderChain struct {
@@ -37,20 +149,47 @@ type HeaderChain struct {
 	currentHeader     atomic.Value      // 标题链的当前头部（可能在块链上方！）
 	currentHeaderHash chain_common.Hash // 标题链当前头部的哈希值（防止重新计算
 
-	headerCache *lru.Cache // 缓存最新的块头
-	tdCache     *lru.Cache // 缓存最近的块总难度
-	numberCache *lru.Cache // 缓存最新的块编号
+	headerCache  *meteredCache // 缓存最新的块头
+	tdCache      *meteredCache // 缓存最近的块总难度
+	numberCache  *meteredCache // 缓存最新的块编号
+	baseFeeCache *meteredCache // 缓存最近的区块基础费用
 
 	procInterrupt func() bool
 
+	reorgFeed    event.Feed        // 规范链重组时发送 ChainReorgEvent
+	reorgLock    sync.Mutex        // 保护 reorgQueue 和 reorgSending
+	reorgQueue   []ChainReorgEvent // 等待发送的重组事件，按发生顺序排列
+	reorgSending bool              // 是否有协程正在发送 reorgQueue 中的事件
+
 	rand   *mrand.Rand
 	engine consensus.Engine
 }
+
+// ChainReorgEvent 在 WriteHeader 将规范链头切换到另一个分叉时发送。 Dropped 和 Added 均按区块编号
+// 升序排列，分别列出离开和进入规范链的区块头哈希。
+type ChainReorgEvent struct {
+	Ancestor *types.Header       // 新旧分支的共同祖先
+	Dropped  []chain_common.Hash // 从规范链中移除的区块头哈希
+	Added    []chain_common.Hash // 新加入规范链的区块头哈希
+}
 // NewHeaderChain 创建一个新的HeaderChain结构。 getValidator 应该返回父的验证器procInterrupt指向父级的中断信号量wg指向父级的关闭等待组
 func NewHeaderChain(chainDb db_model.Database, config *configs.ChainConfig, engine consensus.Engine, procInterrupt func() bool) (*HeaderChain, error) {
-	headerCache, _ := lru.New(headerCacheLimit)
-	tdCache, _ := lru.New(tdCacheLimit)
-	numberCache, _ := lru.New(numberCacheLimit)
+	return NewHeaderChainWithCache(chainDb, config, nil, engine, procInterrupt)
+}
+
+// NewHeaderChainWithCache 与 NewHeaderChain 相同，但使用 cacheConfig 中的缓存容量。 cacheConfig 为 nil 时使用默认容量。
+// 链配置无效（例如奖励计划不一致）时返回错误。 链配置了奖励计划时 engine 由 WithRewardSchedule 包装。
+func NewHeaderChainWithCache(chainDb db_model.Database, config *configs.ChainConfig, cacheConfig *HeaderCacheConfig, engine consensus.Engine, procInterrupt func() bool) (*HeaderChain, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if cacheConfig == nil {
+		cacheConfig = new(HeaderCacheConfig)
+	}
+	headerCache := newMeteredCache(cacheConfig.HeaderCache, headerCacheLimit, headerCacheHitCounter, headerCacheMissCounter)
+	tdCache := newMeteredCache(cacheConfig.TdCache, tdCacheLimit, tdCacheHitCounter, tdCacheMissCounter)
+	numberCache := newMeteredCache(cacheConfig.NumberCache, numberCacheLimit, numberCacheHitCounter, numberCacheMissCounter)
+	baseFeeCache := newMeteredCache(cacheConfig.BaseFeeCache, baseFeeCacheLimit, baseFeeCacheHitCounter, baseFeeCacheMissCounter)
 
 	// 种子快速但加密的始发随机发生器
 	seed, err := crand.Int(crand.Reader, big.NewInt(math.MaxInt64))
@@ -64,9 +203,10 @@ func NewHeaderChain(chainDb db_model.Database, config *configs.ChainConfig, engi
 		headerCache:   headerCache,
 		tdCache:       tdCache,
 		numberCache:   numberCache,
+		baseFeeCache:  baseFeeCache,
 		procInterrupt: procInterrupt,
 		rand:          mrand.New(mrand.NewSource(seed.Int64())),
-		engine:        engine,
+		engine:        WithRewardSchedule(config, engine),
 	}
 
 	hc.genesisHeader = hc.GetHeaderByNumber(0)
@@ -82,6 +222,9 @@ func NewHeaderChain(chainDb db_model.Database, config *configs.ChainConfig, engi
 	}
 	hc.currentHeaderHash = hc.CurrentHeader().Hash()
 
+	if report := hc.PendingSetHead(); report != nil {
+		logger.Warn("发现未完成的回卷，请使用 set-head 命令完成或撤销", "target", report.Target, "headers", report.Headers)
+	}
 	return hc, nil
 }
 // GetBlockNumber从缓存或数据库中检索属于给定哈希的块编号
@@ -106,6 +249,10 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 		hash   = header.Hash()
 		number = header.Number.Uint64()
 	)
+	// 拒绝与可信检查点冲突的区块头
+	if err := hc.verifyCheckpoint(header); err != nil {
+		return NonStatTy, err
+	}
 	// 计算标题的总难度
 	ptd := hc.GetTd(header.ParentHash, number-1)
 	if ptd == nil {
@@ -122,21 +269,39 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 	// 如果总难度高于我们已知的，则将其添加到规范链中if语句中的第二个子句减少了自私挖掘的漏洞。
 	// 请参阅http://www.cs.cornell.edu/~ie53/publications/btcProcFC.pdf
 	if externTd.Cmp(localTd) > 0 || (externTd.Cmp(localTd) == 0 && mrand.Float64() < 0.5) {
+		// 收集离开和进入规范链的区块头，用于通知重组订阅者
+		var (
+			dropped []chain_common.Hash // 新头及以下被覆盖的规范哈希，按编号降序
+			above   []chain_common.Hash // 新头之上被删除的规范哈希，按编号升序
+			added   []chain_common.Hash // 新头以下新写入的规范哈希，按编号降序
+		)
 		// 删除新头上方的任何规范数字分配
 		for i := number + 1; ; i++ {
 			hash := rawdb.ReadCanonicalHash(hc.chainDb, i)
 			if hash == (chain_common.Hash{}) {
 				break
 			}
+			above = append(above, hash)
 			rawdb.DeleteCanonicalHash(hc.chainDb, i)
 		}
+		if old := rawdb.ReadCanonicalHash(hc.chainDb, number); old != (chain_common.Hash{}) && old != hash {
+			dropped = append(dropped, old)
+		}
 		// 覆盖任何过时的规范号码分配
 		var (
 			headHash   = header.ParentHash
 			headNumber = header.Number.Uint64() - 1
 			headHeader = hc.GetHeader(headHash, headNumber)
 		)
-		for rawdb.ReadCanonicalHash(hc.chainDb, headNumber) != headHash {
+		for {
+			old := rawdb.ReadCanonicalHash(hc.chainDb, headNumber)
+			if old == headHash {
+				break
+			}
+			if old != (chain_common.Hash{}) {
+				dropped = append(dropped, old)
+			}
+			added = append(added, headHash)
 			rawdb.WriteCanonicalHash(hc.chainDb, headHash, headNumber)
 
 			headHash = headHeader.ParentHash
@@ -150,6 +315,16 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 		hc.currentHeaderHash = hash
 		hc.currentHeader.Store(types.CopyHeader(header))
 
+		// 只有旧的规范区块被替换时才是重组，单纯的延长不发送事件
+		if len(dropped) > 0 || len(above) > 0 {
+			reverseHashes(dropped)
+			reverseHashes(added)
+			hc.postChainReorg(ChainReorgEvent{
+				Ancestor: headHeader,
+				Dropped:  append(dropped, above...),
+				Added:    append(added, hash),
+			})
+		}
 		status = CanonStatTy
 	} else {
 		status = SideStatTy
@@ -160,26 +335,72 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 
 	return
 }
+// SubscribeChainReorgEvent 注册 ChainReorgEvent 的订阅。 事件在区块头导入之外由单独的协程按发生顺序
+// 发送，读取缓慢的订阅者只会推迟后续事件，不会阻塞 WriteHeader；积压超过 reorgQueueLimit 个事件时
+// 最早的事件被丢弃。
+func (hc *HeaderChain) SubscribeChainReorgEvent(ch chan<- ChainReorgEvent) event.Subscription {
+	return hc.reorgFeed.Subscribe(ch)
+}
+
+// postChainReorg 将重组事件加入发送队列，如果没有协程正在发送则启动一个。 调用者（以及持有的链锁）
+// 不等待订阅者接收事件。 队列中已有 reorgQueueLimit 个事件时丢弃最早的一个并计入 chain/reorg/dropped，
+// 订阅者长期不读取时内存不会无限增长。
+func (hc *HeaderChain) postChainReorg(ev ChainReorgEvent) {
+	hc.reorgLock.Lock()
+	defer hc.reorgLock.Unlock()
+
+	if len(hc.reorgQueue) >= reorgQueueLimit {
+		dropped := hc.reorgQueue[0]
+		hc.reorgQueue = hc.reorgQueue[1:]
+		reorgDroppedCounter.Inc(1)
+		logger.Warn("重组事件积压过多，丢弃最早的事件", "ancestor", dropped.Ancestor.Number, "added", len(dropped.Added))
+	}
+	hc.reorgQueue = append(hc.reorgQueue, ev)
+	if !hc.reorgSending {
+		hc.reorgSending = true
+		go hc.sendChainReorgs()
+	}
+}
+
+// sendChainReorgs 按顺序发送队列中的重组事件，直到队列为空。
+func (hc *HeaderChain) sendChainReorgs() {
+	for {
+		hc.reorgLock.Lock()
+		if len(hc.reorgQueue) == 0 {
+			hc.reorgSending = false
+			hc.reorgLock.Unlock()
+			return
+		}
+		ev := hc.reorgQueue[0]
+		hc.reorgQueue = hc.reorgQueue[1:]
+		hc.reorgLock.Unlock()
+
+		hc.reorgFeed.Send(ev)
+	}
+}
+
+// reverseHashes 原地反转哈希切片。
+func reverseHashes(hashes []chain_common.Hash) {
+	for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+		hashes[i], hashes[j] = hashes[j], hashes[i]
+	}
+}
+
 // WhCallback是一个用于插入单个标头的回调函数。 使用回调有两个原因：首先，在LightChain中，
 // 应处理状态并发送轻链事件，而在BlockChain中这不是必需的，因为在插入块之后发送链事件。
 // 其次，标题写入应该由父链互斥分别保护。
 type WhCallback func(*types.Header) error
 
+// ValidateHeaderChain 校验一批待导入的区块头。 区块头交由共识引擎的 VerifyHeaders 在其工作协程上
+// 并行校验，结果按顺序取回；黑名单和检查点等本地规则在调用者的协程中按顺序检查。 遇到第一个失败时
+// 立即停止，并返回失败区块头的索引。
 func (hc *HeaderChain) ValidateHeaderChain(chain []*types.Header, checkFreq int) (int, error) {
-	// 进行健全性检查，确保所提供的链实际已订购和链接
-	for i := 1; i < len(chain); i++ {
-		if chain[i].Number.Uint64() != chain[i-1].Number.Uint64()+1 || chain[i].ParentHash != chain[i-1].Hash() {
-			// 链打破了祖先，记录消息（编程错误）并跳过插入
-			logger.Error("不连续的标头插入", "编号", chain[i].Number, "哈希", chain[i].Hash(),
-				"parent", chain[i].ParentHash, "prevnumber", chain[i-1].Number, "prevhash", chain[i-1].Hash())
-
-			return 0, fmt.Errorf( i18.I18_print.Sprintf("非连续插入：项目 %d 是 #%d [%x…], 项目 %d 是 #%d [%x…] (父哈希 [%x…])", i-1, chain[i-1].Number,
-				chain[i-1].Hash().Bytes()[:4], i, chain[i].Number, chain[i].Hash().Bytes()[:4], chain[i].ParentHash[:4]))
-		}
+	if i, err := verifyContiguous(chain); err != nil {
+		return i, err
 	}
-	
 	abort, results := hc.engine.VerifyHeaders(hc, chain)
 	defer close(abort)
+
 	// 迭代标题并确保它们全部结账
 	for i, header := range chain {
 		// 如果链正在终止，则停止处理块
@@ -187,12 +408,7 @@ func (hc *HeaderChain) ValidateHeaderChain(chain []*types.Header, checkFreq int)
 			logger.Debug("标头验证过早中止")
 			return 0, errors.New("中止")
 		}
-		// 如果标题是禁止标题，则直接中止
-		if BadHashes[header.Hash()] {
-			return i, ErrBlacklistedHash
-		}
-		// 否则等待标题检查并确保它们通过
-		if err := <-results; err != nil {
+		if err := hc.verifyImported(header, <-results); err != nil {
 			return i, err
 		}
 	}
@@ -200,10 +416,59 @@ func (hc *HeaderChain) ValidateHeaderChain(chain []*types.Header, checkFreq int)
 	return 0, nil
 }
 
+// ValidateAndInsertHeaderChain 以流水线方式校验并插入一批区块头：共识引擎在后台按顺序送出校验结果，
+// 每个区块头一旦通过校验立即写入，而不必等待整批校验完成。 遇到第一个失败时停止，返回失败区块头的
+// 索引，失败之前的区块头已经写入。
+func (hc *HeaderChain) ValidateAndInsertHeaderChain(chain []*types.Header, writeHeader WhCallback, start time.Time) (int, error) {
+	if i, err := verifyContiguous(chain); err != nil {
+		return i, err
+	}
+	abort, results := hc.engine.VerifyHeaders(hc, chain)
+	defer close(abort)
+
+	return hc.insertHeaderChain(chain, results, writeHeader, start)
+}
+
+// verifyContiguous 进行健全性检查，确保所提供的链实际已订购和链接。
+func verifyContiguous(chain []*types.Header) (int, error) {
+	for i := 1; i < len(chain); i++ {
+		if chain[i].Number.Uint64() != chain[i-1].Number.Uint64()+1 || chain[i].ParentHash != chain[i-1].Hash() {
+			// 链打破了祖先，记录消息（编程错误）并跳过插入
+			logger.Error("不连续的标头插入", "编号", chain[i].Number, "哈希", chain[i].Hash(),
+				"parent", chain[i].ParentHash, "prevnumber", chain[i-1].Number, "prevhash", chain[i-1].Hash())
+
+			return 0, fmt.Errorf( i18.I18_print.Sprintf("非连续插入：项目 %d 是 #%d [%x…], 项目 %d 是 #%d [%x…] (父哈希 [%x…])", i-1, chain[i-1].Number,
+				chain[i-1].Hash().Bytes()[:4], i, chain[i].Number, chain[i].Hash().Bytes()[:4], chain[i].ParentHash[:4]))
+		}
+	}
+	return 0, nil
+}
+
+// verifyImported 将共识引擎对区块头的校验结果与黑名单和检查点等本地规则合并。
+func (hc *HeaderChain) verifyImported(header *types.Header, engineErr error) error {
+	// 如果标题是禁止标题，则直接中止
+	if BadHashes[header.Hash()] {
+		return ErrBlacklistedHash
+	}
+	if engineErr != nil {
+		logger.Debug("区块头校验失败", "number", header.Number, "hash", header.Hash(), "err", engineErr)
+		return newBlockVerifyError(header, engineErr)
+	}
+	if err := hc.verifyCheckpoint(header); err != nil {
+		return newBlockVerifyError(header, err)
+	}
+	return nil
+}
+
 // InsertHeaderChain尝试将给定的标题链插入到本地链中，可能会创建一个重组。 如果返回错误，它将返回失败标头的索引号以及描述错误的错误。
 //
 //验证参数可用于微调是否应该进行随机数验证。 可选检查背后的原因是因为某些标头检索机制已经需要验证nonce，以及因为nonce可以稀疏地验证，而不需要检查每个。
 func (hc *HeaderChain) InsertHeaderChain(chain []*types.Header, writeHeader WhCallback, start time.Time) (int, error) {
+	return hc.insertHeaderChain(chain, nil, writeHeader, start)
+}
+
+// insertHeaderChain 逐个写入区块头。 results 不为 nil 时，每个区块头写入前先等待它的校验结果。
+func (hc *HeaderChain) insertHeaderChain(chain []*types.Header, results <-chan error, writeHeader WhCallback, start time.Time) (int, error) {
 	//收集一些导入统计信息以进行报告
 	stats := struct{ processed, ignored int }{}
 	//所有标头都通过验证，将它们导入数据库
@@ -213,6 +478,11 @@ func (hc *HeaderChain) InsertHeaderChain(chain []*types.Header, writeHeader WhCa
 			logger.Debug("标头导入期间过早中止")
 			return i, errors.New("中止")
 		}
+		if results != nil {
+			if err := hc.verifyImported(header, <-results); err != nil {
+				return i, err
+			}
+		}
 		//如果标题已知，请跳过它，否则存储
 		if hc.HasHeader(header.Hash(), header.Number.Uint64()) {
 			stats.ignored++
@@ -223,6 +493,9 @@ func (hc *HeaderChain) InsertHeaderChain(chain []*types.Header, writeHeader WhCa
 		}
 		stats.processed++
 	}
+	if len(chain) == 0 {
+		return 0, nil
+	}
 	//报告一些公共统计数据，以便用户知道发生了什么
 	last := chain[len(chain)-1]
 	logger.Info("导入的新块头", "count", stats.processed, "elapsed", chain_common.PrettyDuration(time.Since(start)),
@@ -369,49 +642,220 @@ func (hc *HeaderChain) SetCurrentHeader(head *types.Header) {
 // DeleteCallback是一个回调函数，在删除每个标题之前由SetHead调用。
 type DeleteCallback func(chain_common.Hash, uint64)
 // SetHead 将本地链回卷到新头。 新头部上方的所有内容都将被删除，新的头部将被删除。
+// 如果新头低于当前链已经越过的最新检查点，则不做任何修改，只记录错误；需要知道回卷是否执行的
+// 调用者应使用 TrySetHead。
 func (hc *HeaderChain) SetHead(head uint64, delFn DeleteCallback) {
+	if err := hc.TrySetHead(head, delFn); err != nil {
+		logger.Error("无法回卷区块头链", "target", head, "err", err)
+	}
+}
 
-	height := uint64(0)
+// TrySetHead 与 SetHead 相同，但在拒绝回卷时返回错误。 如果新头低于当前链已经越过的最新检查点，
+// 则返回 ErrRewindBelowCheckpoint。
+//
+// 删除开始前，回卷的目标、起始高度和链头会先写入数据库中的回卷日志，每个区块头删除之前也会先写入
+// 日志，因此被中断的回卷可以在重启后通过 ResumeSetHead 或再次调用 SetHead 完成，或通过
+// RollbackSetHead 撤销。
+func (hc *HeaderChain) TrySetHead(head uint64, delFn DeleteCallback) error {
+	report, err := hc.planSetHead(head)
+	if err != nil {
+		return err
+	}
+	current := hc.CurrentHeader()
+	journal := &setHeadJournal{Target: head, Height: current.Number.Uint64(), Head: current.Hash()}
 
-	if hdr := hc.CurrentHeader() ; hdr != nil {
-		height = hdr.Number.Uint64()
+	// 如果上一次回卷被中断，链头以上可能还残留着它的区块头，一并清理，撤销时恢复到它开始前的链头
+	if pending := hc.readSetHeadJournal(); pending != nil && pending.Height > journal.Height {
+		journal.Height, journal.Head = pending.Height, pending.Head
 	}
+	if err := hc.writeSetHeadJournal(journal); err != nil {
+		return err
+	}
+	hc.applySetHead(journal, delFn)
 
-	for hdr := hc.CurrentHeader(); hdr != nil && hdr.Number.Uint64() > head; hdr = hc.CurrentHeader() {
-		hash := hdr.Hash()
-		num := hdr.Number.Uint64()
-		if delFn != nil {
-			delFn(hash, num)
-		}
-		rawdb.DeleteHeader(hc.chainDb, hash, num)
-		rawdb.DeleteTd(hc.chainDb, hash, num)
+	logger.Info("已回卷区块头链", "target", head, "headers", report.Headers, "tds", report.Tds, "canonical", report.CanonicalHashes)
 
-		hc.currentHeader.Store(hc.GetHeader(hdr.ParentHash, hdr.Number.Uint64()-1))
+	return hc.deleteSetHeadJournal(journal)
+}
+
+// SetHeadDryRun 报告 SetHead(head) 将会删除多少区块头、总难度条目和规范哈希映射，但不修改数据库。
+func (hc *HeaderChain) SetHeadDryRun(head uint64) (*SetHeadReport, error) {
+	return hc.planSetHead(head)
+}
+
+// applySetHead 从当前链头开始逐个删除高于回卷目标的区块头、总难度和规范哈希。 每一步都先持久化新的
+// 链头再删除旧链头，因此在任意位置中断后重复执行都是安全的。
+func (hc *HeaderChain) applySetHead(journal *setHeadJournal, delFn DeleteCallback) {
+	// 清除上一次中断时已经移走链头、但尚未删除的区块头
+	for i := journal.Height; i > hc.CurrentHeader().Number.Uint64(); i-- {
+		if hash := rawdb.ReadCanonicalHash(hc.chainDb, i); hash != (chain_common.Hash{}) {
+			hc.deleteHeader(hash, i, delFn)
+		}
 	}
-	// 回滚规范链编号
-	for i := height; i > head; i-- {
-		rawdb.DeleteCanonicalHash(hc.chainDb, i)
+	for hdr := hc.CurrentHeader(); hdr.Number.Uint64() > journal.Target; hdr = hc.CurrentHeader() {
+		parent := hc.GetHeader(hdr.ParentHash, hdr.Number.Uint64()-1)
+		if parent == nil {
+			parent = hc.genesisHeader
+		}
+		hc.SetCurrentHeader(parent)
+		hc.deleteHeader(hdr.Hash(), hdr.Number.Uint64(), delFn)
 	}
 	// 清除缓存中的任何陈旧内容
 	hc.headerCache.Purge()
 	hc.tdCache.Purge()
 	hc.numberCache.Purge()
+}
 
-	if hc.CurrentHeader() == nil {
-		hc.currentHeader.Store(hc.genesisHeader)
+// deleteHeader 先把区块头及其总难度写入回卷日志，再删除区块头、总难度和规范哈希映射，delFn 不为 nil 时
+// 在删除之前通知调用者。 日志条目无法写入时进程退出，没有记录的区块头不会被删除。
+func (hc *HeaderChain) deleteHeader(hash chain_common.Hash, number uint64, delFn DeleteCallback) {
+	if err := hc.journalSetHeadEntry(hash, number); err != nil {
+		logger.Crit("无法写入回卷日志条目", "number", number, "hash", hash, "err", err)
 	}
-	hc.currentHeaderHash = hc.CurrentHeader().Hash()
+	if delFn != nil {
+		delFn(hash, number)
+	}
+	rawdb.DeleteHeader(hc.chainDb, hash, number)
+	rawdb.DeleteTd(hc.chainDb, hash, number)
+	if rawdb.ReadCanonicalHash(hc.chainDb, number) == hash {
+		rawdb.DeleteCanonicalHash(hc.chainDb, number)
+	}
+}
 
-	rawdb.WriteHeadHeaderHash(hc.chainDb, hc.currentHeaderHash)
+// StartFromCheckpoint 让尚未同步的节点（例如轻节点）从一个可信的检查点区块头开始，而不必从创世区块
+// 同步整条链。 header 必须与链配置中同一高度的检查点一致，td 是该区块头的总难度。 区块头作为新的
+// 链头写入，之后导入的区块头从它开始连接；创世区块和检查点之间的区块头保持缺失。 本地链已经达到该
+// 高度时不做任何修改。
+func (hc *HeaderChain) StartFromCheckpoint(header *types.Header, td *big.Int) error {
+	var (
+		hash   = header.Hash()
+		number = header.Number.Uint64()
+	)
+	if cp, ok := hc.config.CheckpointHash(number); !ok || cp != hash {
+		return ErrUntrustedHeader
+	}
+	if hc.CurrentHeader().Number.Uint64() >= number {
+		return nil
+	}
+	if err := hc.WriteTd(hash, number, td); err != nil {
+		return err
+	}
+	rawdb.WriteHeader(hc.chainDb, header)
+	rawdb.WriteCanonicalHash(hc.chainDb, hash, number)
+
+	hc.headerCache.Add(hash, header)
+	hc.numberCache.Add(hash, number)
+	hc.SetCurrentHeader(types.CopyHeader(header))
+
+	logger.Info("从可信检查点开始区块头链", "number", number, "hash", hash, "td", td)
+	return nil
+}
+
+// VerifyUnconfirmBlock 校验一个尚未写入本地链的区块（例如从节点拉取的区块）。 它检查父区块
+// 链接、时间戳、gas 限制和额外数据，检查区块体与区块头中的交易根和叔块哈希一致，并交由共识引擎
+// 校验密封。 父区块必须已在本地存在；编号为 0 的区块只与本地创世区块比较。
+func (hc *HeaderChain) VerifyUnconfirmBlock(block *types.Block) error {
+	header := block.Header()
+
+	// 创世区块没有父区块，只能与本地创世区块比较
+	if header.Number.Sign() == 0 {
+		if header.Hash() != hc.genesisHeader.Hash() {
+			return newBlockVerifyError(header, ErrInvalidGenesis)
+		}
+		return nil
+	}
+	parent := hc.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return newBlockVerifyError(header, consensus.ErrUnknownAncestor)
+	}
+	if err := hc.verifyHeader(header, parent); err != nil {
+		return newBlockVerifyError(header, err)
+	}
+	if err := verifyBody(block); err != nil {
+		return newBlockVerifyError(header, err)
+	}
+	if err := hc.engine.VerifySeal(hc, header); err != nil {
+		logger.Debug("区块密封校验失败", "number", header.Number, "hash", header.Hash(), "err", err)
+		return newBlockVerifyError(header, ErrInvalidSeal)
+	}
+	return nil
+}
+
+// VerifyConfirmedBlock 校验一个声称已被确认的区块。 除了与 VerifyUnconfirmBlock 相同的检查外，
+// 该区块还必须是本地规范链在其高度上的区块。
+func (hc *HeaderChain) VerifyConfirmedBlock(block *types.Block) error {
+	header := block.Header()
+
+	if rawdb.ReadCanonicalHash(hc.chainDb, header.Number.Uint64()) != header.Hash() {
+		return newBlockVerifyError(header, ErrNotCanonical)
+	}
+	return hc.VerifyUnconfirmBlock(block)
 }
 
-func (self *HeaderChain) VerifyUnconfirmBlock(block *types.Block) error{
+// verifyHeader 对区块头执行与共识引擎无关的检查：父区块链接、编号、检查点、时间戳单调性、
+// gas 限制范围以及额外数据大小。 区块头不携带基础费用，因此这里不校验基础费用。
+func (hc *HeaderChain) verifyHeader(header, parent *types.Header) error {
+	if header.ParentHash != parent.Hash() {
+		return ErrInvalidParent
+	}
+	if header.Number.Uint64() != parent.Number.Uint64()+1 {
+		return ErrInvalidBlockNumber
+	}
+	if err := hc.verifyCheckpoint(header); err != nil {
+		return err
+	}
+	if header.Time.Cmp(parent.Time) <= 0 {
+		return ErrInvalidTimestamp
+	}
+	if uint64(len(header.Extra)) > configs.MaximumExtraDataSize {
+		return ErrExtraDataTooLong
+	}
+	// gas 限制必须 <= 2^63-1，且不能低于协议下限
+	if header.GasLimit > math.MaxInt64 || header.GasLimit < configs.MinGasLimit {
+		return ErrInvalidGasLimit
+	}
+	if header.GasUsed > header.GasLimit {
+		return ErrInvalidGasUsed
+	}
+	// 相对父区块的 gas 限制调整幅度必须在 1/GasLimitBoundDivisor 以内
+	diff := int64(parent.GasLimit) - int64(header.GasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	if uint64(diff) >= parent.GasLimit/configs.GasLimitBoundDivisor {
+		return ErrInvalidGasLimit
+	}
+	return nil
+}
+
+// verifyBody 检查区块体中的交易和叔块与区块头中的交易根和叔块哈希是否一致。
+func verifyBody(block *types.Block) error {
+	header := block.Header()
+	if hash := types.CalcUncleHash(block.Uncles()); hash != header.UncleHash {
+		return ErrInvalidUncleHash
+	}
+	if hash := types.DeriveSha(block.Transactions()); hash != header.TxHash {
+		return ErrInvalidTxRoot
+	}
 	return nil
 }
 
-func (self *HeaderChain) VerifyConfirmedBlock(block *types.Block) error {
+// verifyCheckpoint 检查区块头是否与链配置中同一高度的检查点一致。
+func (hc *HeaderChain) verifyCheckpoint(header *types.Header) error {
+	if hash, ok := hc.config.CheckpointHash(header.Number.Uint64()); ok && hash != header.Hash() {
+		return ErrCheckpointMismatch
+	}
 	return nil
 }
+
+// newBlockVerifyError 用给定区块头的编号和哈希包装校验错误。
+func newBlockVerifyError(header *types.Header, err error) *BlockVerifyError {
+	return &BlockVerifyError{
+		Number: header.Number.Uint64(),
+		Hash:   header.Hash(),
+		Err:    err,
+	}
+}
 // SetGenesis 为链设置一个新的genesis块头
 func (hc *HeaderChain) SetGenesis(head *types.Header) {
 	hc.genesisHeader = head
@@ -0,0 +1,95 @@
+package chain_core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/i18"
+	"github.com/aidoc/go-aidoc/lib/rawdb"
+)
+
+// ErrHeaderIteratorReorg 在迭代过程中规范链发生重组、相邻区块头不再相连时返回。
+var ErrHeaderIteratorReorg = errors.New("迭代期间规范链发生了重组")
+
+// HeaderIterator 按编号顺序流式读取两个高度之间（包含两端）的规范区块头，方向可以是升序或降序。
+//
+// 迭代器是拉取式的：只有调用 Next 时才会从数据库读取下一个区块头，因此消费者的处理速度
+// 自然决定了读取速度。 读取绕过 HeaderChain 的缓存，以免大批量导出冲掉热点数据。
+type HeaderIterator struct {
+	hc      *HeaderChain
+	next    uint64        // 下一个要读取的区块编号
+	last    uint64        // 最后一个要读取的区块编号
+	reverse bool          // 是否按编号降序迭代
+	done    bool          // 迭代是否已经结束
+	header  *types.Header // 当前区块头
+	err     error         // 迭代失败的原因
+}
+
+// HeaderRange 返回一个遍历 [from, to] 之间规范区块头的迭代器。 当 from > to 时按编号降序迭代。
+// 超出当前链头的部分会被截断。
+func (hc *HeaderChain) HeaderRange(from, to uint64) *HeaderIterator {
+	it := &HeaderIterator{hc: hc, next: from, last: to, reverse: from > to}
+
+	head := hc.CurrentHeader().Number.Uint64()
+	if it.reverse {
+		if it.next > head {
+			it.next = head
+		}
+		it.done = it.next < it.last
+	} else {
+		if it.last > head {
+			it.last = head
+		}
+		it.done = it.next > it.last
+	}
+	return it
+}
+
+// Next 读取下一个区块头，如果迭代结束或失败则返回 false。 失败原因可以通过 Err 获取。
+func (it *HeaderIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	hash := rawdb.ReadCanonicalHash(it.hc.chainDb, it.next)
+	if hash == (chain_common.Hash{}) {
+		return it.fail(fmt.Errorf(i18.I18_print.Sprintf("缺少规范区块头 #%d", it.next)))
+	}
+	header := rawdb.ReadHeader(it.hc.chainDb, hash, it.next)
+	if header == nil {
+		return it.fail(fmt.Errorf(i18.I18_print.Sprintf("缺少区块头 #%d [%x…]", it.next, hash.Bytes()[:4])))
+	}
+	// 确认与上一个区块头仍然相连，否则说明迭代期间发生了重组
+	if prev := it.header; prev != nil {
+		if (!it.reverse && header.ParentHash != prev.Hash()) || (it.reverse && prev.ParentHash != hash) {
+			return it.fail(ErrHeaderIteratorReorg)
+		}
+	}
+	it.header = header
+
+	if it.next == it.last {
+		it.done = true
+	} else if it.reverse {
+		it.next--
+	} else {
+		it.next++
+	}
+	return true
+}
+
+// Header 返回最近一次 Next 读取的区块头。
+func (it *HeaderIterator) Header() *types.Header {
+	return it.header
+}
+
+// Err 返回导致迭代提前结束的错误，正常结束时返回 nil。
+func (it *HeaderIterator) Err() error {
+	return it.err
+}
+
+// fail 记录错误并结束迭代。
+func (it *HeaderIterator) fail(err error) bool {
+	it.err, it.done, it.header = err, true, nil
+	return false
+}
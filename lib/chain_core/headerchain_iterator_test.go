@@ -0,0 +1,81 @@
+package chain_core
+
+import (
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+)
+
+func TestHeaderRange(t *testing.T) {
+	hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+	headers := append([]*types.Header{hc.genesisHeader}, makeTestHeaders(hc.genesisHeader, 10, 0)...)
+	writeTestHeaders(t, hc, headers[1:])
+
+	tests := []struct {
+		from, to uint64
+		want     []uint64
+	}{
+		{0, 3, []uint64{0, 1, 2, 3}},
+		{7, 7, []uint64{7}},
+		{8, 20, []uint64{8, 9, 10}},
+		{3, 0, []uint64{3, 2, 1, 0}},
+		{20, 8, []uint64{10, 9, 8}},
+		{11, 20, nil},
+		{20, 11, nil},
+	}
+	for i, test := range tests {
+		var got []uint64
+		it := hc.HeaderRange(test.from, test.to)
+		for it.Next() {
+			number := it.Header().Number.Uint64()
+			if it.Header().Hash() != headers[number].Hash() {
+				t.Errorf("测试 %d: 区块头 #%d 不是规范区块头", i, number)
+			}
+			got = append(got, number)
+		}
+		if err := it.Err(); err != nil {
+			t.Errorf("测试 %d: 迭代失败: %v", i, err)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("测试 %d: 区块编号不匹配: 得到 %v, 需要 %v", i, got, test.want)
+			continue
+		}
+		for j := range got {
+			if got[j] != test.want[j] {
+				t.Errorf("测试 %d: 区块编号不匹配: 得到 %v, 需要 %v", i, got, test.want)
+				break
+			}
+		}
+		if it.Next() {
+			t.Errorf("测试 %d: 迭代结束后 Next 仍返回 true", i)
+		}
+	}
+}
+
+func TestHeaderRangeReorg(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+		headers := makeTestHeaders(hc.genesisHeader, 6, 0)
+		writeTestHeaders(t, hc, headers)
+
+		it := hc.HeaderRange(1, 6)
+		if reverse {
+			it = hc.HeaderRange(6, 1)
+		}
+		for i := 0; i < 2; i++ {
+			if !it.Next() {
+				t.Fatalf("reverse=%v: 重组前迭代失败: %v", reverse, it.Err())
+			}
+		}
+		// 从 #1 分叉的更重的链替换 #2 及以上的规范区块头
+		writeTestHeaders(t, hc, makeTestHeaders(headers[0], 5, 1))
+
+		if it.Next() {
+			t.Fatalf("reverse=%v: 重组后迭代没有停止, 得到 #%d", reverse, it.Header().Number)
+		}
+		if it.Err() != ErrHeaderIteratorReorg {
+			t.Fatalf("reverse=%v: 错误不匹配: 得到 %v, 需要 %v", reverse, it.Err(), ErrHeaderIteratorReorg)
+		}
+	}
+}
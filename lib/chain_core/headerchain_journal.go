@@ -0,0 +1,216 @@
+package chain_core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/logger"
+	"github.com/aidoc/go-aidoc/lib/rawdb"
+	"github.com/aidoc/go-aidoc/lib/rlp"
+)
+
+var (
+	// setHeadJournalKey 是数据库中保存未完成回卷日志的键。
+	setHeadJournalKey = []byte("SetHeadJournal")
+
+	// setHeadEntryPrefix + num (uint64 big endian) -> 回卷删除的区块头及其总难度
+	setHeadEntryPrefix = []byte("SetHeadJournal-")
+)
+
+// ErrNoSetHeadJournal 在没有未完成的回卷日志时由 ResumeSetHead 和 RollbackSetHead 返回。
+var ErrNoSetHeadJournal = errors.New("没有未完成的回卷")
+
+// SetHeadReport 描述一次回卷将会删除的数据量。
+type SetHeadReport struct {
+	Target          uint64 // 回卷的目标高度
+	Headers         int    // 将被删除的区块头数量
+	Tds             int    // 将被删除的总难度条目数量
+	CanonicalHashes int    // 将被删除的规范哈希映射数量
+}
+
+// setHeadJournal 记录一次正在进行的回卷。 回卷从链头开始逐个删除区块头，每一步都先把持久化的链头
+// 移到父区块头再删除旧链头，因此链头本身就是回卷的进度。 链头以上仍然存在的规范哈希映射属于中断时
+// 尚未删除完的区块头。
+//
+// 每个区块头在删除之前先和它的总难度一起按编号写入单独的日志条目，因此 RollbackSetHead 可以撤销
+// 被中断的回卷，而日志本身的大小与回卷深度无关。
+type setHeadJournal struct {
+	Target uint64            // 回卷的目标高度
+	Height uint64            // 回卷开始前的链头高度
+	Head   chain_common.Hash // 回卷开始前的链头哈希
+}
+
+// setHeadJournalEntry 是回卷日志中一个被删除的区块头及其总难度。
+type setHeadJournalEntry struct {
+	Header *types.Header
+	Td     *big.Int
+}
+
+// setHeadEntryKey = setHeadEntryPrefix + num (uint64 big endian)
+func setHeadEntryKey(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return append(append([]byte{}, setHeadEntryPrefix...), enc...)
+}
+
+// countSetHead 统计 (target, height] 范围内的规范哈希映射以及它们指向的区块头和总难度，不修改数据库。
+func (hc *HeaderChain) countSetHead(target, height uint64) *SetHeadReport {
+	report := &SetHeadReport{Target: target}
+	for i := height; i > target; i-- {
+		hash := rawdb.ReadCanonicalHash(hc.chainDb, i)
+		if hash == (chain_common.Hash{}) {
+			continue
+		}
+		report.CanonicalHashes++
+		if rawdb.HasHeader(hc.chainDb, hash, i) {
+			report.Headers++
+		}
+		if rawdb.ReadTd(hc.chainDb, hash, i) != nil {
+			report.Tds++
+		}
+	}
+	return report
+}
+
+// planSetHead 检查是否允许回卷到 head，并统计回卷将删除的数据，但不修改数据库。
+func (hc *HeaderChain) planSetHead(head uint64) (*SetHeadReport, error) {
+	height := hc.CurrentHeader().Number.Uint64()
+	if cp := hc.config.LatestCheckpoint(height); cp != nil && head < cp.Number {
+		logger.Warn("拒绝回卷到检查点以下", "target", head, "checkpoint", cp.Number, "hash", cp.Hash)
+		return nil, ErrRewindBelowCheckpoint
+	}
+	return hc.countSetHead(head, height), nil
+}
+
+// writeSetHeadJournal 将回卷日志写入数据库。
+func (hc *HeaderChain) writeSetHeadJournal(journal *setHeadJournal) error {
+	blob, err := rlp.EncodeToBytes(journal)
+	if err != nil {
+		return err
+	}
+	return hc.chainDb.Put(setHeadJournalKey, blob)
+}
+
+// readSetHeadJournal 从数据库读取未完成的回卷日志，如果不存在则返回 nil。
+func (hc *HeaderChain) readSetHeadJournal() *setHeadJournal {
+	blob, err := hc.chainDb.Get(setHeadJournalKey)
+	if err != nil || len(blob) == 0 {
+		return nil
+	}
+	journal := new(setHeadJournal)
+	if err := rlp.DecodeBytes(blob, journal); err != nil {
+		logger.Error("无效的回卷日志", "err", err)
+		return nil
+	}
+	return journal
+}
+
+// readSetHeadEntry 读取编号为 number 的日志条目，如果不存在则返回 nil。
+func (hc *HeaderChain) readSetHeadEntry(number uint64) *setHeadJournalEntry {
+	blob, err := hc.chainDb.Get(setHeadEntryKey(number))
+	if err != nil || len(blob) == 0 {
+		return nil
+	}
+	entry := new(setHeadJournalEntry)
+	if err := rlp.DecodeBytes(blob, entry); err != nil {
+		logger.Error("无效的回卷日志条目", "number", number, "err", err)
+		return nil
+	}
+	return entry
+}
+
+// journalSetHeadEntry 在删除之前把区块头及其总难度写入日志条目。 中断后重复删除同一个区块头时，
+// 它可能已经被部分删除，因此已经记录的条目不会被覆盖。
+func (hc *HeaderChain) journalSetHeadEntry(hash chain_common.Hash, number uint64) error {
+	if entry := hc.readSetHeadEntry(number); entry != nil && entry.Header.Hash() == hash {
+		return nil
+	}
+	header := rawdb.ReadHeader(hc.chainDb, hash, number)
+	if header == nil {
+		return nil
+	}
+	blob, err := rlp.EncodeToBytes(&setHeadJournalEntry{Header: header, Td: rawdb.ReadTd(hc.chainDb, hash, number)})
+	if err != nil {
+		return err
+	}
+	return hc.chainDb.Put(setHeadEntryKey(number), blob)
+}
+
+// deleteSetHeadJournal 在回卷完成或撤销后删除日志。 条目先于日志删除，因此残留的条目总是属于
+// 一个仍然存在的日志。
+func (hc *HeaderChain) deleteSetHeadJournal(journal *setHeadJournal) error {
+	for i := journal.Height; i > journal.Target; i-- {
+		if err := hc.chainDb.Delete(setHeadEntryKey(i)); err != nil {
+			return err
+		}
+	}
+	return hc.chainDb.Delete(setHeadJournalKey)
+}
+
+// PendingSetHead 返回上一次被中断的回卷尚未删除的数据量，如果没有未完成的回卷则返回 nil。
+func (hc *HeaderChain) PendingSetHead() *SetHeadReport {
+	journal := hc.readSetHeadJournal()
+	if journal == nil {
+		return nil
+	}
+	return hc.countSetHead(journal.Target, journal.Height)
+}
+
+// ResumeSetHead 从持久化的链头继续完成一次被中断的回卷。
+func (hc *HeaderChain) ResumeSetHead(delFn DeleteCallback) error {
+	journal := hc.readSetHeadJournal()
+	if journal == nil {
+		return ErrNoSetHeadJournal
+	}
+	// 回卷的进度保存在区块头链头中，它可能与当前内存中的链头不同
+	if head := hc.GetHeaderByHash(rawdb.ReadHeadHeaderHash(hc.chainDb)); head != nil {
+		hc.SetCurrentHeader(head)
+	}
+	hc.applySetHead(journal, delFn)
+
+	logger.Info("已完成中断的回卷", "target", journal.Target, "height", journal.Height)
+	return hc.deleteSetHeadJournal(journal)
+}
+
+// RollbackSetHead 撤销一次被中断的回卷，从日志条目恢复已经删除的区块头、总难度和规范哈希，
+// 并把链头恢复为回卷开始前的链头。
+//
+// 注意：只能恢复区块头链自身的数据，DeleteCallback 在回卷期间删除的数据（例如区块体）不会被恢复。
+func (hc *HeaderChain) RollbackSetHead() error {
+	journal := hc.readSetHeadJournal()
+	if journal == nil {
+		return ErrNoSetHeadJournal
+	}
+	// 持久化的链头及其以下的区块头还没有被删除，只恢复链头以上的条目
+	head := journal.Target
+	if header := hc.GetHeaderByHash(rawdb.ReadHeadHeaderHash(hc.chainDb)); header != nil && header.Number.Uint64() > head {
+		head = header.Number.Uint64()
+	}
+	restored := 0
+	for i := journal.Height; i > head; i-- {
+		entry := hc.readSetHeadEntry(i)
+		if entry == nil {
+			continue
+		}
+		hash := entry.Header.Hash()
+
+		rawdb.WriteHeader(hc.chainDb, entry.Header)
+		if entry.Td != nil {
+			rawdb.WriteTd(hc.chainDb, hash, i, entry.Td)
+		}
+		rawdb.WriteCanonicalHash(hc.chainDb, hash, i)
+		restored++
+	}
+	hc.headerCache.Purge()
+	hc.tdCache.Purge()
+	hc.numberCache.Purge()
+
+	if header := hc.GetHeaderByHash(journal.Head); header != nil {
+		hc.SetCurrentHeader(header)
+	}
+	logger.Info("已撤销中断的回卷", "target", journal.Target, "height", journal.Height, "headers", restored)
+	return hc.deleteSetHeadJournal(journal)
+}
@@ -0,0 +1,644 @@
+package chain_core
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/rawdb"
+	"github.com/aidoc/go-aidoc/service/db_model"
+	"github.com/aidoc/go-aidoc/service/produce/consensus"
+)
+
+// errTestBadSeal 是 testEngine 对 badSeals 中的区块头返回的错误。
+var errTestBadSeal = errors.New("密封无效")
+
+// testEngine 是只实现测试所需方法的共识引擎，badSeals 中的区块头密封校验失败。
+type testEngine struct {
+	consensus.Engine
+	badSeals map[chain_common.Hash]bool
+}
+
+func (e *testEngine) Author(header *types.Header) (chain_common.Address, error) {
+	return header.Coinbase, nil
+}
+
+func (e *testEngine) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	if e.badSeals[header.Hash()] {
+		return errTestBadSeal
+	}
+	return nil
+}
+
+func (e *testEngine) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header) (chan<- struct{}, <-chan error) {
+	abort, results := make(chan struct{}), make(chan error, len(headers))
+	go func() {
+		for _, header := range headers {
+			select {
+			case results <- e.VerifySeal(chain, header):
+			case <-abort:
+				return
+			}
+		}
+	}()
+	return abort, results
+}
+
+// newTestHeaderChain 创建一个只包含创世区块头的内存区块头链。
+func newTestHeaderChain(t *testing.T, config *configs.ChainConfig, engine consensus.Engine) *HeaderChain {
+	hc, err := NewHeaderChain(newTestGenesisDatabase(), config, engine, func() bool { return false })
+	if err != nil {
+		t.Fatalf("无法创建区块头链: %v", err)
+	}
+	return hc
+}
+
+// newTestGenesisDatabase 创建一个只写入了创世区块头的内存数据库。
+func newTestGenesisDatabase() db_model.Database {
+	db := db_model.NewMemDatabase()
+	genesis := &types.Header{
+		Number:     big.NewInt(0),
+		Time:       big.NewInt(0),
+		GasLimit:   8000000,
+		Difficulty: big.NewInt(1),
+		TxHash:     types.EmptyRootHash,
+		UncleHash:  types.EmptyUncleHash,
+	}
+	rawdb.WriteHeader(db, genesis)
+	rawdb.WriteTd(db, genesis.Hash(), 0, genesis.Difficulty)
+	rawdb.WriteCanonicalHash(db, genesis.Hash(), 0)
+	rawdb.WriteHeadHeaderHash(db, genesis.Hash())
+
+	return db
+}
+
+// makeTestHeaders 在 parent 之上生成 n 个连续的区块头。 seed 写入额外数据以区分不同分叉，
+// 并决定区块头的难度（1+seed），使不同分叉的总难度不会相等。
+func makeTestHeaders(parent *types.Header, n int, seed byte) []*types.Header {
+	headers := make([]*types.Header, n)
+	for i := range headers {
+		headers[i] = &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
+			Time:       new(big.Int).Add(parent.Time, big.NewInt(10)),
+			GasLimit:   parent.GasLimit,
+			Difficulty: big.NewInt(1 + int64(seed)),
+			Extra:      []byte{seed},
+			TxHash:     types.EmptyRootHash,
+			UncleHash:  types.EmptyUncleHash,
+		}
+		parent = headers[i]
+	}
+	return headers
+}
+
+// writeTestHeaders 将区块头逐个写入区块头链。
+func writeTestHeaders(t *testing.T, hc *HeaderChain, headers []*types.Header) {
+	for _, header := range headers {
+		if _, err := hc.WriteHeader(header); err != nil {
+			t.Fatalf("无法写入区块头 #%d: %v", header.Number, err)
+		}
+	}
+}
+
+func TestVerifyUnconfirmBlock(t *testing.T) {
+	engine := &testEngine{badSeals: make(map[chain_common.Hash]bool)}
+	hc := newTestHeaderChain(t, configs.TestChainConfig, engine)
+
+	headers := makeTestHeaders(hc.genesisHeader, 3, 0)
+	writeTestHeaders(t, hc, headers[:2])
+	parent := headers[1]
+
+	// mutate 复制下一个区块头并修改，以得到恰好违反一条规则的区块
+	mutate := func(fn func(header *types.Header)) *types.Block {
+		header := types.CopyHeader(headers[2])
+		fn(header)
+		return types.NewBlockWithHeader(header)
+	}
+	badSeal := mutate(func(header *types.Header) { header.Extra = []byte("bad seal") })
+	engine.badSeals[badSeal.Hash()] = true
+
+	tx := types.NewTransaction(0, chain_common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	tests := []struct {
+		block *types.Block
+		err   error
+	}{
+		{types.NewBlockWithHeader(headers[2]), nil},
+		{types.NewBlockWithHeader(hc.genesisHeader), nil},
+		{mutate(func(header *types.Header) { header.Number = big.NewInt(0) }), ErrInvalidGenesis},
+		{mutate(func(header *types.Header) { header.ParentHash = chain_common.Hash{0x01} }), consensus.ErrUnknownAncestor},
+		{mutate(func(header *types.Header) { header.Time = new(big.Int).Set(parent.Time) }), ErrInvalidTimestamp},
+		{mutate(func(header *types.Header) { header.Extra = make([]byte, configs.MaximumExtraDataSize+1) }), ErrExtraDataTooLong},
+		{mutate(func(header *types.Header) { header.GasLimit = parent.GasLimit * 2 }), ErrInvalidGasLimit},
+		{mutate(func(header *types.Header) { header.GasUsed = header.GasLimit + 1 }), ErrInvalidGasUsed},
+		{mutate(func(header *types.Header) { header.UncleHash = chain_common.Hash{0x01} }), ErrInvalidUncleHash},
+		{types.NewBlockWithHeader(headers[2]).WithBody(types.Transactions{tx}, nil), ErrInvalidTxRoot},
+		{badSeal, ErrInvalidSeal},
+	}
+	for i, test := range tests {
+		err := hc.VerifyUnconfirmBlock(test.block)
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("测试 %d: 意外的错误: %v", i, err)
+			}
+			continue
+		}
+		var verr *BlockVerifyError
+		if !errors.As(err, &verr) {
+			t.Errorf("测试 %d: 需要 *BlockVerifyError, 得到 %v", i, err)
+			continue
+		}
+		if verr.Number != test.block.NumberU64() || verr.Hash != test.block.Hash() {
+			t.Errorf("测试 %d: 错误的区块: 得到 #%d [%x], 需要 #%d [%x]", i, verr.Number, verr.Hash, test.block.NumberU64(), test.block.Hash())
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("测试 %d: 错误不匹配: 得到 %v, 需要 %v", i, err, test.err)
+		}
+	}
+}
+
+func TestVerifyConfirmedBlock(t *testing.T) {
+	hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+
+	canon := makeTestHeaders(hc.genesisHeader, 2, 0)
+	side := makeTestHeaders(hc.genesisHeader, 1, 1)
+	writeTestHeaders(t, hc, canon)
+
+	if err := hc.VerifyConfirmedBlock(types.NewBlockWithHeader(canon[1])); err != nil {
+		t.Fatalf("规范区块校验失败: %v", err)
+	}
+	if err := hc.VerifyConfirmedBlock(types.NewBlockWithHeader(side[0])); !errors.Is(err, ErrNotCanonical) {
+		t.Fatalf("错误不匹配: 得到 %v, 需要 %v", err, ErrNotCanonical)
+	}
+}
+
+func TestValidateHeaderChain(t *testing.T) {
+	engine := &testEngine{badSeals: make(map[chain_common.Hash]bool)}
+	hc := newTestHeaderChain(t, configs.TestChainConfig, engine)
+
+	headers := makeTestHeaders(hc.genesisHeader, 16, 0)
+	if i, err := hc.ValidateHeaderChain(headers, 1); err != nil {
+		t.Fatalf("有效的区块头在 %d 校验失败: %v", i, err)
+	}
+	// 不连续的区块头在交给引擎之前就被拒绝
+	gapped := append(append([]*types.Header{}, headers[:4]...), headers[5:]...)
+	if _, err := hc.ValidateHeaderChain(gapped, 1); err == nil {
+		t.Fatalf("不连续的区块头通过了校验")
+	}
+	// 第一个失败的区块头决定返回的索引
+	engine.badSeals[headers[9].Hash()] = true
+	engine.badSeals[headers[12].Hash()] = true
+
+	i, err := hc.ValidateHeaderChain(headers, 1)
+	if i != 9 {
+		t.Fatalf("失败索引不匹配: 得到 %d, 需要 %d", i, 9)
+	}
+	var verr *BlockVerifyError
+	if !errors.As(err, &verr) || verr.Hash != headers[9].Hash() || !errors.Is(err, errTestBadSeal) {
+		t.Fatalf("错误不匹配: 得到 %v", err)
+	}
+}
+
+func TestValidateAndInsertHeaderChain(t *testing.T) {
+	engine := &testEngine{badSeals: make(map[chain_common.Hash]bool)}
+	hc := newTestHeaderChain(t, configs.TestChainConfig, engine)
+
+	headers := makeTestHeaders(hc.genesisHeader, 8, 0)
+	engine.badSeals[headers[5].Hash()] = true
+
+	write := func(header *types.Header) error {
+		_, err := hc.WriteHeader(header)
+		return err
+	}
+	i, err := hc.ValidateAndInsertHeaderChain(headers, write, time.Now())
+	if i != 5 || !errors.Is(err, errTestBadSeal) {
+		t.Fatalf("结果不匹配: 得到 (%d, %v), 需要 (5, %v)", i, err, errTestBadSeal)
+	}
+	// 失败之前的区块头已经写入，失败的及其后的区块头没有写入
+	for j, header := range headers {
+		if have := hc.HasHeader(header.Hash(), header.Number.Uint64()); have != (j < 5) {
+			t.Errorf("区块头 %d: 是否存在 %v, 需要 %v", j, have, j < 5)
+		}
+	}
+	if head := hc.CurrentHeader().Hash(); head != headers[4].Hash() {
+		t.Errorf("链头不匹配: 得到 %x, 需要 %x", head, headers[4].Hash())
+	}
+	// 修复密封后重新导入，已写入的区块头被跳过
+	delete(engine.badSeals, headers[5].Hash())
+	if i, err := hc.ValidateAndInsertHeaderChain(headers, write, time.Now()); err != nil {
+		t.Fatalf("重新导入在 %d 失败: %v", i, err)
+	}
+	if head := hc.CurrentHeader().Hash(); head != headers[7].Hash() {
+		t.Errorf("链头不匹配: 得到 %x, 需要 %x", head, headers[7].Hash())
+	}
+}
+
+func TestChainReorgEvent(t *testing.T) {
+	hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+
+	oldChain := makeTestHeaders(hc.genesisHeader, 3, 0)
+	newChain := makeTestHeaders(hc.genesisHeader, 3, 1)
+	writeTestHeaders(t, hc, oldChain)
+
+	events := make(chan ChainReorgEvent, 4)
+	sub := hc.SubscribeChainReorgEvent(events)
+	defer sub.Unsubscribe()
+
+	// 新分叉的难度为 2，写入第二个区块头时总难度超过旧链并触发重组，第三个区块头只是延长
+	writeTestHeaders(t, hc, newChain)
+
+	hashes := func(headers []*types.Header) []chain_common.Hash {
+		list := make([]chain_common.Hash, len(headers))
+		for i, header := range headers {
+			list[i] = header.Hash()
+		}
+		return list
+	}
+	select {
+	case ev := <-events:
+		if ev.Ancestor.Hash() != hc.genesisHeader.Hash() {
+			t.Errorf("共同祖先不匹配: 得到 %x, 需要 %x", ev.Ancestor.Hash(), hc.genesisHeader.Hash())
+		}
+		if !reflect.DeepEqual(ev.Dropped, hashes(oldChain)) {
+			t.Errorf("移除的区块头不匹配: 得到 %x, 需要 %x", ev.Dropped, hashes(oldChain))
+		}
+		if !reflect.DeepEqual(ev.Added, hashes(newChain[:2])) {
+			t.Errorf("加入的区块头不匹配: 得到 %x, 需要 %x", ev.Added, hashes(newChain[:2]))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("没有收到重组事件")
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("延长规范链时收到多余的重组事件: %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChainReorgEventSlowSubscriber(t *testing.T) {
+	hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+	writeTestHeaders(t, hc, makeTestHeaders(hc.genesisHeader, 1, 0))
+
+	// 无缓冲且不读取的订阅者不能阻塞区块头写入
+	events := make(chan ChainReorgEvent)
+	sub := hc.SubscribeChainReorgEvent(events)
+	defer sub.Unsubscribe()
+
+	// 创世区块之上难度递增的兄弟区块头，每一个都会替换前一个成为规范链头
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for seed := byte(1); seed <= 3; seed++ {
+			if _, err := hc.WriteHeader(makeTestHeaders(hc.genesisHeader, 1, seed)[0]); err != nil {
+				t.Errorf("无法写入区块头: %v", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("区块头写入被订阅者阻塞")
+	}
+	// 积压的事件仍然按顺序送达
+	for seed := byte(1); seed <= 3; seed++ {
+		select {
+		case ev := <-events:
+			want := makeTestHeaders(hc.genesisHeader, 1, seed)[0].Hash()
+			if len(ev.Added) != 1 || ev.Added[0] != want {
+				t.Fatalf("事件 %d: 加入的区块头不匹配: 得到 %x, 需要 %x", seed, ev.Added, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("没有收到第 %d 个重组事件", seed)
+		}
+	}
+}
+
+func TestChainReorgQueueLimit(t *testing.T) {
+	hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+
+	events := make(chan ChainReorgEvent)
+	sub := hc.SubscribeChainReorgEvent(events)
+	defer sub.Unsubscribe()
+
+	// 订阅者不读取时积压的事件不超过上限，超出的部分从最早的事件开始丢弃
+	posted := 2 * reorgQueueLimit
+	for i := 0; i < posted; i++ {
+		hc.postChainReorg(ChainReorgEvent{Ancestor: &types.Header{Number: big.NewInt(int64(i))}})
+	}
+	hc.reorgLock.Lock()
+	queued := len(hc.reorgQueue)
+	hc.reorgLock.Unlock()
+	if queued > reorgQueueLimit {
+		t.Fatalf("积压的事件超过上限: 得到 %d, 上限 %d", queued, reorgQueueLimit)
+	}
+	// 剩余的事件仍然按顺序送达，最后一个事件不会被丢弃
+	var received []int64
+	for len(received) == 0 || received[len(received)-1] != int64(posted-1) {
+		select {
+		case ev := <-events:
+			received = append(received, ev.Ancestor.Number.Int64())
+		case <-time.After(time.Second):
+			t.Fatalf("没有收到最后的重组事件, 已收到 %d 个", len(received))
+		}
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i] <= received[i-1] {
+			t.Fatalf("事件顺序错误: %d 在 %d 之后", received[i], received[i-1])
+		}
+	}
+	// 最多一个事件正在发送，其余的都在队列中
+	if len(received) > reorgQueueLimit+1 {
+		t.Errorf("收到的事件超过上限: 得到 %d, 上限 %d", len(received), reorgQueueLimit+1)
+	}
+}
+
+// checkpointConfig 返回在 header 的高度上配置了检查点的测试链配置副本。
+func checkpointConfig(headers ...*types.Header) *configs.ChainConfig {
+	config := *configs.TestChainConfig
+	for _, header := range headers {
+		config.Checkpoints = append(config.Checkpoints, configs.Checkpoint{Number: header.Number.Uint64(), Hash: header.Hash()})
+	}
+	return &config
+}
+
+func TestCheckpointEnforced(t *testing.T) {
+	genesis := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{}).genesisHeader
+	canon := makeTestHeaders(genesis, 4, 0)
+	side := makeTestHeaders(genesis, 4, 1)
+
+	hc := newTestHeaderChain(t, checkpointConfig(canon[1]), &testEngine{})
+
+	// 与检查点冲突的区块头在校验和写入时都被拒绝
+	i, err := hc.ValidateHeaderChain(side, 1)
+	if i != 1 || !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("校验结果不匹配: 得到 (%d, %v), 需要 (1, %v)", i, err, ErrCheckpointMismatch)
+	}
+	writeTestHeaders(t, hc, side[:1])
+	if _, err := hc.WriteHeader(side[1]); err != ErrCheckpointMismatch {
+		t.Fatalf("写入错误不匹配: 得到 %v, 需要 %v", err, ErrCheckpointMismatch)
+	}
+	// 与检查点一致的区块头被接受
+	if i, err := hc.ValidateHeaderChain(canon, 1); err != nil {
+		t.Fatalf("规范区块头在 %d 校验失败: %v", i, err)
+	}
+	writeTestHeaders(t, hc, canon)
+
+	// 不能回卷到检查点以下，SetHead 在拒绝时不修改链
+	if err := hc.TrySetHead(0, nil); err != ErrRewindBelowCheckpoint {
+		t.Fatalf("回卷错误不匹配: 得到 %v, 需要 %v", err, ErrRewindBelowCheckpoint)
+	}
+	hc.SetHead(1, nil)
+	if head := hc.CurrentHeader().Hash(); head != canon[3].Hash() {
+		t.Fatalf("被拒绝的回卷修改了链头: 得到 %x, 需要 %x", head, canon[3].Hash())
+	}
+	// 回卷到检查点本身是允许的
+	if err := hc.TrySetHead(2, nil); err != nil {
+		t.Fatalf("无法回卷到检查点: %v", err)
+	}
+	if head := hc.CurrentHeader().Hash(); head != canon[1].Hash() {
+		t.Fatalf("链头不匹配: 得到 %x, 需要 %x", head, canon[1].Hash())
+	}
+}
+
+func TestStartFromCheckpoint(t *testing.T) {
+	genesis := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{}).genesisHeader
+	headers := makeTestHeaders(genesis, 12, 0)
+
+	hc := newTestHeaderChain(t, checkpointConfig(headers[9]), &testEngine{})
+
+	// 只有配置的检查点可以作为起点
+	if err := hc.StartFromCheckpoint(headers[8], big.NewInt(10)); err != ErrUntrustedHeader {
+		t.Fatalf("错误不匹配: 得到 %v, 需要 %v", err, ErrUntrustedHeader)
+	}
+	if err := hc.StartFromCheckpoint(headers[9], big.NewInt(11)); err != nil {
+		t.Fatalf("无法从检查点开始: %v", err)
+	}
+	if head := hc.CurrentHeader().Hash(); head != headers[9].Hash() {
+		t.Fatalf("链头不匹配: 得到 %x, 需要 %x", head, headers[9].Hash())
+	}
+	// 检查点之后的区块头直接连接到检查点上
+	writeTestHeaders(t, hc, headers[10:])
+	if head := hc.CurrentHeader().Hash(); head != headers[11].Hash() {
+		t.Fatalf("链头不匹配: 得到 %x, 需要 %x", head, headers[11].Hash())
+	}
+	if td := hc.GetTdByHash(headers[11].Hash()); td.Cmp(big.NewInt(13)) != 0 {
+		t.Fatalf("总难度不匹配: 得到 %v, 需要 %v", td, 13)
+	}
+	if hc.GetHeaderByNumber(5) != nil {
+		t.Fatalf("检查点以下不应该有区块头")
+	}
+}
+
+func TestInvalidChainConfig(t *testing.T) {
+	config := *configs.TestChainConfig
+	config.Reward = &configs.RewardConfig{TreasuryShare: 6000, BurnShare: 5000}
+
+	if _, err := NewHeaderChain(newTestGenesisDatabase(), &config, &testEngine{}, func() bool { return false }); err == nil {
+		t.Fatalf("使用无效的奖励配置创建了区块头链")
+	}
+}
+
+func TestHeaderCacheConfig(t *testing.T) {
+	// fill 向缓存写入 n 个不同的键，返回缓存最终保留的条目数
+	fill := func(cache *meteredCache, n int) int {
+		for i := 0; i < n; i++ {
+			cache.Add(i, i)
+		}
+		return cache.Len()
+	}
+	config := &HeaderCacheConfig{HeaderCache: 2, TdCache: 3, NumberCache: 4, BaseFeeCache: 5}
+	hc, err := NewHeaderChainWithCache(newTestGenesisDatabase(), configs.TestChainConfig, config, &testEngine{}, func() bool { return false })
+	if err != nil {
+		t.Fatalf("无法创建区块头链: %v", err)
+	}
+	tests := []struct {
+		name  string
+		cache *meteredCache
+		size  int
+	}{
+		{"header", hc.headerCache, config.HeaderCache},
+		{"td", hc.tdCache, config.TdCache},
+		{"number", hc.numberCache, config.NumberCache},
+		{"basefee", hc.baseFeeCache, config.BaseFeeCache},
+	}
+	for _, test := range tests {
+		if n := fill(test.cache, 100); n != test.size {
+			t.Errorf("%s 缓存容量不匹配: 得到 %d, 需要 %d", test.name, n, test.size)
+		}
+	}
+	// 未设置的容量使用默认值
+	hc, err = NewHeaderChainWithCache(newTestGenesisDatabase(), configs.TestChainConfig, &HeaderCacheConfig{TdCache: 7}, &testEngine{}, func() bool { return false })
+	if err != nil {
+		t.Fatalf("无法创建区块头链: %v", err)
+	}
+	if n := fill(hc.tdCache, 100); n != 7 {
+		t.Errorf("td 缓存容量不匹配: 得到 %d, 需要 %d", n, 7)
+	}
+	if n := fill(hc.headerCache, 2*headerCacheLimit); n != headerCacheLimit {
+		t.Errorf("区块头缓存容量不匹配: 得到 %d, 需要 %d", n, headerCacheLimit)
+	}
+}
+
+func TestSetHeadDryRun(t *testing.T) {
+	hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+	headers := makeTestHeaders(hc.genesisHeader, 10, 0)
+	writeTestHeaders(t, hc, headers)
+
+	report, err := hc.SetHeadDryRun(4)
+	if err != nil {
+		t.Fatalf("无法预览回卷: %v", err)
+	}
+	if want := (SetHeadReport{Target: 4, Headers: 6, Tds: 6, CanonicalHashes: 6}); *report != want {
+		t.Fatalf("报告不匹配: 得到 %+v, 需要 %+v", *report, want)
+	}
+	if head := hc.CurrentHeader().Hash(); head != headers[9].Hash() {
+		t.Fatalf("预览修改了链头: 得到 %x, 需要 %x", head, headers[9].Hash())
+	}
+	var deleted []uint64
+	if err := hc.TrySetHead(4, func(hash chain_common.Hash, number uint64) { deleted = append(deleted, number) }); err != nil {
+		t.Fatalf("无法回卷: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []uint64{10, 9, 8, 7, 6, 5}) {
+		t.Fatalf("删除回调不匹配: 得到 %v", deleted)
+	}
+	checkRewound(t, hc, headers, 4)
+}
+
+func TestResumeSetHead(t *testing.T) {
+	hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+	headers := makeTestHeaders(hc.genesisHeader, 10, 0)
+	writeTestHeaders(t, hc, headers)
+
+	// 模拟回卷到 #4 时在删除 #8 的过程中中断：持久化的链头已经移到 #7，#8 及其映射还没有删除
+	if err := hc.writeSetHeadJournal(&setHeadJournal{Target: 4, Height: 10}); err != nil {
+		t.Fatalf("无法写入回卷日志: %v", err)
+	}
+	for _, header := range headers[8:] {
+		hc.deleteHeader(header.Hash(), header.Number.Uint64(), nil)
+	}
+	hc.SetCurrentHeader(headers[6])
+
+	// 重启后从持久化的链头继续
+	restarted, err := NewHeaderChain(hc.chainDb, configs.TestChainConfig, &testEngine{}, func() bool { return false })
+	if err != nil {
+		t.Fatalf("无法重新打开区块头链: %v", err)
+	}
+	if want := (SetHeadReport{Target: 4, Headers: 4, Tds: 4, CanonicalHashes: 4}); *restarted.PendingSetHead() != want {
+		t.Fatalf("未完成的回卷不匹配: 得到 %+v, 需要 %+v", *restarted.PendingSetHead(), want)
+	}
+	var deleted []uint64
+	if err := restarted.ResumeSetHead(func(hash chain_common.Hash, number uint64) { deleted = append(deleted, number) }); err != nil {
+		t.Fatalf("无法完成回卷: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []uint64{8, 7, 6, 5}) {
+		t.Fatalf("删除回调不匹配: 得到 %v", deleted)
+	}
+	checkRewound(t, restarted, headers, 4)
+
+	if err := restarted.ResumeSetHead(nil); err != ErrNoSetHeadJournal {
+		t.Fatalf("错误不匹配: 得到 %v, 需要 %v", err, ErrNoSetHeadJournal)
+	}
+}
+
+func TestRollbackSetHead(t *testing.T) {
+	hc := newTestHeaderChain(t, configs.TestChainConfig, &testEngine{})
+	headers := makeTestHeaders(hc.genesisHeader, 10, 0)
+	writeTestHeaders(t, hc, headers)
+
+	tds := make([]*big.Int, len(headers))
+	for i, header := range headers {
+		tds[i] = rawdb.ReadTd(hc.chainDb, header.Hash(), header.Number.Uint64())
+	}
+	// 回卷到 #4 时在删除 #7 的过程中中断：持久化的链头已经移到 #6，#10 到 #8 已经删除
+	func() {
+		defer func() { recover() }()
+		hc.TrySetHead(4, func(hash chain_common.Hash, number uint64) {
+			if number == 7 {
+				panic("中断")
+			}
+		})
+	}()
+	if head := rawdb.ReadHeadHeaderHash(hc.chainDb); head != headers[5].Hash() {
+		t.Fatalf("中断时持久化的链头不匹配: 得到 %x, 需要 %x", head, headers[5].Hash())
+	}
+	if rawdb.HasHeader(hc.chainDb, headers[8].Hash(), 9) {
+		t.Fatalf("中断之前的区块头没有被删除")
+	}
+	// 重启后撤销回卷，区块头、总难度、规范哈希和链头都恢复到回卷开始之前
+	restarted, err := NewHeaderChain(hc.chainDb, configs.TestChainConfig, &testEngine{}, func() bool { return false })
+	if err != nil {
+		t.Fatalf("无法重新打开区块头链: %v", err)
+	}
+	if err := restarted.RollbackSetHead(); err != nil {
+		t.Fatalf("无法撤销回卷: %v", err)
+	}
+	if head := restarted.CurrentHeader().Hash(); head != headers[9].Hash() {
+		t.Fatalf("链头不匹配: 得到 %x, 需要 %x", head, headers[9].Hash())
+	}
+	if head := rawdb.ReadHeadHeaderHash(restarted.chainDb); head != headers[9].Hash() {
+		t.Fatalf("持久化的链头不匹配: 得到 %x, 需要 %x", head, headers[9].Hash())
+	}
+	for i, header := range headers {
+		var (
+			hash   = header.Hash()
+			number = header.Number.Uint64()
+		)
+		if restarted.GetHeader(hash, number) == nil {
+			t.Errorf("区块头 #%d 没有恢复", number)
+		}
+		if td := rawdb.ReadTd(restarted.chainDb, hash, number); td == nil || td.Cmp(tds[i]) != 0 {
+			t.Errorf("总难度 #%d 不匹配: 得到 %v, 需要 %v", number, td, tds[i])
+		}
+		if rawdb.ReadCanonicalHash(restarted.chainDb, number) != hash {
+			t.Errorf("规范哈希 #%d 没有恢复", number)
+		}
+		if restarted.readSetHeadEntry(number) != nil {
+			t.Errorf("撤销后仍有回卷日志条目 #%d", number)
+		}
+	}
+	if restarted.PendingSetHead() != nil {
+		t.Fatalf("撤销后仍有回卷日志")
+	}
+	if err := restarted.RollbackSetHead(); err != ErrNoSetHeadJournal {
+		t.Fatalf("错误不匹配: 得到 %v, 需要 %v", err, ErrNoSetHeadJournal)
+	}
+}
+
+// checkRewound 检查区块头链已经回卷到 headers 中编号为 target 的区块头，且没有遗留回卷日志。
+func checkRewound(t *testing.T, hc *HeaderChain, headers []*types.Header, target uint64) {
+	t.Helper()
+
+	if head := hc.CurrentHeader().Hash(); head != headers[target-1].Hash() {
+		t.Fatalf("链头不匹配: 得到 %x, 需要 %x", head, headers[target-1].Hash())
+	}
+	if head := rawdb.ReadHeadHeaderHash(hc.chainDb); head != headers[target-1].Hash() {
+		t.Fatalf("持久化的链头不匹配: 得到 %x, 需要 %x", head, headers[target-1].Hash())
+	}
+	for _, header := range headers {
+		var (
+			hash   = header.Hash()
+			number = header.Number.Uint64()
+			keep   = number <= target
+		)
+		if rawdb.HasHeader(hc.chainDb, hash, number) != keep {
+			t.Errorf("区块头 #%d: 是否存在 %v, 需要 %v", number, !keep, keep)
+		}
+		if (rawdb.ReadTd(hc.chainDb, hash, number) != nil) != keep {
+			t.Errorf("总难度 #%d: 是否存在 %v, 需要 %v", number, !keep, keep)
+		}
+		if (rawdb.ReadCanonicalHash(hc.chainDb, number) == hash) != keep {
+			t.Errorf("规范哈希 #%d: 是否存在 %v, 需要 %v", number, !keep, keep)
+		}
+		if hc.readSetHeadEntry(number) != nil {
+			t.Errorf("回卷完成后仍有回卷日志条目 #%d", number)
+		}
+	}
+	if hc.PendingSetHead() != nil {
+		t.Fatalf("回卷完成后仍有回卷日志")
+	}
+}
@@ -3,6 +3,8 @@
 package chain_core
 
 import (
+	"math/big"
+
 	"github.com/aidoc/go-aidoc/configs"
 	"github.com/aidoc/go-aidoc/lib/chain_common"
 	"github.com/aidoc/go-aidoc/lib/chain_core/types"
@@ -19,19 +21,35 @@ type StateProcessor struct {
 	config *configs.ChainConfig // 链配置选项
 	bc     *BlockChain          // 规范块链
 	engine consensus.Engine     // 用于块奖励的共识引擎
+
+	parallel int         // 推测并行执行交易的工作协程数量（<= 1 表示串行执行）
+	tracer   BlockTracer // 可选的区块执行跟踪器
 }
-// NewState Processor初始化一个新的状态处理器。
+
+// NewState Processor初始化一个新的状态处理器。 链配置了奖励计划时 engine 由 WithRewardSchedule 包装。
 func NewStateProcessor(config *configs.ChainConfig, bc *BlockChain, engine consensus.Engine) *StateProcessor {
 	return &StateProcessor{
 		config: config,
 		bc:     bc,
-		engine: engine,
+		engine: WithRewardSchedule(config, engine),
 	}
 }
 
+// SetParallelism 设置推测并行执行交易时使用的工作协程数量。 workers <= 1 时恢复严格串行执行。
+// 并行模式产生的收据、日志和使用的gas与串行执行完全一致。
+func (p *StateProcessor) SetParallelism(workers int) {
+	p.parallel = workers
+}
+
+// SetTracer 设置区块执行跟踪器，nil 表示关闭跟踪。 跟踪开启时交易总是串行执行。
+func (p *StateProcessor) SetTracer(tracer BlockTracer) {
+	p.tracer = tracer
+}
+
 // 进程通过使用 statedb 运行交易消息并将任何奖励应用于处理器（coinbase）和任何包含的叔区块，根据Aidoc规则处理状态更改。
 //
 // 流程返回流程中累积的收据和日志，并返回流程中使用的gas量。 如果任何交易因 gas 不足而未能执行，则会返回错误。
+// 交易执行失败时返回的错误是 *TxError，其中记录了交易在区块中的位置。
 func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
 	var (
 		receipts types.Receipts
@@ -40,54 +58,110 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		allLogs  []*types.Log
 		gp       = new(GasPool).AddGas(block.GasLimit()) //在一个block处理过程中，GasPool的值可以获得还剩GAS可以使用
 	)
+	// 先在所有核心上并行恢复交易的发送者并填充缓存，恢复失败的交易会在执行时按位置报告错误
+	types.RecoverSenders(types.MakeTypedSigner(p.config, header.Number), block.Transactions())
+
+	// 基础费用对整个区块相同，只计算一次
+	baseFee := chainBaseFee(p.config, p.bc, header)
+
 	//// 根据任何硬叉规范改变块和状态
 	//if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 	//	misc.ApplyDAOHardFork(statedb)
 	//}
+	// 开启并行模式时推测执行交易，冲突的交易会按顺序重新执行。 跟踪需要逐笔观察状态，因此只在串行模式下进行
+	var err error
+	if p.parallel > 1 && p.tracer == nil && len(block.Transactions()) > 1 {
+		receipts, allLogs, err = p.processParallel(block, p.bc, statedb, gp, baseFee, usedGas, cfg)
+	} else {
+		receipts, allLogs, err = p.processSerial(block, p.bc, statedb, gp, baseFee, usedGas, cfg)
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// 最终确定块，应用任何共识引擎特定的额外内容（例如块奖励，配置了奖励计划时由 WithRewardSchedule 替换）
+	if p.tracer != nil {
+		p.finalizeTraced(block, statedb, receipts)
+	} else {
+		p.engine.Finalize(p.bc, header, statedb, block.Transactions(), receipts)
+	}
+	return receipts, allLogs, *usedGas, nil
+}
+
+// processSerial 按区块顺序逐笔执行交易，跟踪开启时同时报告每笔交易的状态变化。 baseFee 是区块的基础费用，
+// 动态费用分叉之前为 nil。
+func (p *StateProcessor) processSerial(block *types.Block, chain ChainContext, statedb *state.StateDB, gp *GasPool, baseFee *big.Int, usedGas *uint64, cfg vm.Config) (types.Receipts, []*types.Log, error) {
+	var (
+		receipts types.Receipts
+		allLogs  []*types.Log
+		header   = block.Header()
+	)
 	// 迭代并处理各个交易
 	for i, tx := range block.Transactions() {
 		statedb.Prepare(tx.Hash(), block.Hash(), i)
-		receipt, _, err := ApplyTransaction(p.config, p.bc, nil, gp, statedb, header, tx, usedGas, cfg)
+
+		var (
+			receipt *types.Receipt
+			err     error
+		)
+		if p.tracer != nil {
+			receipt, err = p.applyTracedTransaction(block, chain, i, gp, statedb, baseFee, usedGas, cfg)
+		} else {
+			receipt, _, err = applyTransaction(p.config, chain, nil, gp, statedb, statedb, header, tx, baseFee, usedGas, cfg)
+		}
 		if err != nil {
-			return nil, nil, 0, err
+			return nil, nil, withTxIndex(err, i)
 		}
 		receipts = append(receipts, receipt)
 		allLogs = append(allLogs, receipt.Logs...)
 	}
-	// 最终确定块，应用任何共识引擎特定的额外内容（例如块奖励）
-	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), receipts)
-
-	return receipts, allLogs, *usedGas, nil
+	return receipts, allLogs, nil
 }
 
 // ApplyTransaction尝试将交易应用于给定的状态数据库，并将输入参数用于其环境。 它返回交易的
-// 收据，使用的gas，如果交易失败则返回错误，表示块无效。
+// 收据，使用的gas，如果交易失败则返回错误，表示块无效。 返回的错误总是 *TxError。
 func ApplyTransaction(config *configs.ChainConfig, bc ChainContext, author *chain_common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, cfg vm.Config) (*types.Receipt, uint64, error) {
-	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number))
+	return applyTransaction(config, bc, author, gp, statedb, statedb, header, tx, chainBaseFee(config, bc, header), usedGas, cfg)
+}
+
+// applyTransaction 与 ApplyTransaction 相同，但 EVM 通过 vmdb 访问状态，并使用调用方已经计算好的区块基础费用
+// baseFee。 vmdb 必须是 statedb 本身或对它的包装，调用方可以借此观察交易执行期间的状态访问。
+func applyTransaction(config *configs.ChainConfig, bc ChainContext, author *chain_common.Address, gp *GasPool, statedb *state.StateDB, vmdb vm.StateDB, header *types.Header, tx *types.Transaction, baseFee *big.Int, usedGas *uint64, cfg vm.Config) (*types.Receipt, uint64, error) {
+	msg, err := tx.AsMessage(types.MakeTypedSigner(config, header.Number))
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, newTxError(tx, err)
 	}
+	return applyTransactionMessage(config, bc, author, gp, statedb, vmdb, header, tx, msg, baseFee, usedGas, cfg)
+}
+
+// applyTransactionMessage 以 msg 作为交易的消息执行交易并创建收据。 它是区块处理和模拟执行共享的执行路径，
+// 模拟执行可以传入不是从签名恢复的消息。 返回的错误总是 *TxError。
+func applyTransactionMessage(config *configs.ChainConfig, bc ChainContext, author *chain_common.Address, gp *GasPool, statedb *state.StateDB, vmdb vm.StateDB, header *types.Header, tx *types.Transaction, msg types.Message, baseFee *big.Int, usedGas *uint64, cfg vm.Config) (*types.Receipt, uint64, error) {
 	// 创建要在EVM环境中使用的新上下文
 	context := NewEVMContext(msg, header, bc, author)
 
 	// 创建一个新环境，其中包含有关transaction和调用机制的所有相关信息。
-	vmenv := vm.NewEVM(context, statedb, config, cfg)
+	vmenv := vm.NewEVM(context, vmdb, config, cfg)
 
 	// 将transaction应用于当前状态（包含在env中）
-	_, gas, failed, err := ApplyMessage(vmenv, msg, gp)
+	gas, failed, err := applyTypedMessage(vmenv, tx, msg, gp, baseFee)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, newTxError(tx, err)
 	}
+	receipt := newTransactionReceipt(config, statedb, header, tx, msg.From(), gas, failed, usedGas)
+
+	return receipt, gas, err
+}
 
-	// 使用挂起更改更新状态
+// newTransactionReceipt 在交易执行完毕后最终确定状态更改，累加使用的gas，并为交易创建收据。
+func newTransactionReceipt(config *configs.ChainConfig, statedb *state.StateDB, header *types.Header, tx *types.Transaction, from chain_common.Address, gas uint64, failed bool, usedGas *uint64) *types.Receipt {
+	// 使用挂起更改更新状态，链配置决定收据是否携带交易后的中间状态根
 	var root []byte
 
-	//if config.IsByzantium(header.Number) {
-	//	statedb.Finalise(true)
-	//} else {
-	//	root = statedb.IntermediateRoot(true/*config.IsEIP158(header.Number)*/).Bytes()
-	//}
-	statedb.Finalise(true)
+	if config.IsReceiptRoot(header.Number) {
+		root = statedb.IntermediateRoot(true).Bytes()
+	} else {
+		statedb.Finalise(true)
+	}
 	*usedGas += gas
 
 	// 为交易创建一个新收据，根据eip阶段存储tx使用的中间根和gas，我们正在通过 root touch-delete账户。
@@ -96,13 +170,13 @@ func ApplyTransaction(config *configs.ChainConfig, bc ChainContext, author *chai
 	receipt.GasUsed = gas
 
 	// 如果交易创建了合同，则将创建地址存储在收据中。
-	if msg.To() == nil {
-		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, tx.Nonce())
+	if tx.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(from, tx.Nonce())
 	}
 
 	// 设置收据日志并创建用于过滤的bloom
 	receipt.Logs = statedb.GetLogs(tx.Hash())
 	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
 
-	return receipt, gas, err
+	return receipt
 }
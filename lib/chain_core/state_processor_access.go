@@ -0,0 +1,118 @@
+package chain_core
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+)
+
+var (
+	// ErrFeeCapTooLow 在交易的费用上限低于区块的基础费用时返回。 基础费用下降后交易可能重新可以执行。
+	ErrFeeCapTooLow = errors.New("交易的费用上限低于区块的基础费用")
+
+	// ErrTipAboveFeeCap 在交易的小费上限高于费用上限时返回。
+	ErrTipAboveFeeCap = errors.New("交易的小费上限高于费用上限")
+
+	// ErrInsufficientFeePayerFunds 在代付账户的余额不足以支付交易的 gas 费用时返回。
+	ErrInsufficientFeePayerFunds = errors.New("代付账户余额不足以支付 gas 费用")
+
+	// errMissingBaseFee 在动态费用分叉之后无法确定区块的基础费用（缺少祖先区块头）时返回。
+	errMissingBaseFee = errors.New("无法确定区块的基础费用")
+)
+
+// applyTypedMessage 在 ApplyMessage 之前处理类型化交易和动态费用的附加规则，返回使用的gas（包括访问列表的gas）
+// 以及执行是否失败。
+//
+// 访问列表的每个账户和存储槽按 TxAccessListAddressGas 和 TxAccessListStorageKeyGas 计入交易的内在gas，
+// 从区块 gas 池和消息的 gas 限制中扣除并按交易的gas价格支付给 coinbase。 EVM 不对列表中的账户和存储槽
+// 给予gas折扣，列表只用于收费，不会预先读取状态。
+//
+// 动态费用分叉之后 baseFee 是区块的基础费用：交易按 min(费用上限, baseFee + 小费上限) 支付gas，执行后
+// 从 coinbase 收回每单位gas baseFee 的部分并销毁，coinbase 只保留小费。
+//
+// 代付gas的交易由代付账户支付访问列表的gas；执行所需的 gas 费用在执行前从代付账户转给发送者，执行后把退还给发送者的未使用部分转回
+// 代付账户，因此发送者只支付转账金额。 返回错误时调用方必须丢弃对状态的修改。
+func applyTypedMessage(vmenv *vm.EVM, tx *types.Transaction, msg types.Message, gp *GasPool, baseFee *big.Int) (uint64, bool, error) {
+	config, number := vmenv.ChainConfig(), vmenv.BlockNumber
+
+	switch tx.Type() {
+	case types.AccessListTxType:
+		if !config.IsAccessList(number) {
+			return 0, false, types.ErrTxTypeNotSupported
+		}
+	case types.DynamicFeeTxType:
+		if !config.IsDynamicFee(number) {
+			return 0, false, types.ErrTxTypeNotSupported
+		}
+	case types.FeePayerTxType:
+		if !config.IsFeePayer(number) {
+			return 0, false, types.ErrTxTypeNotSupported
+		}
+	}
+	dynamicFee := config.IsDynamicFee(number)
+	if dynamicFee {
+		if baseFee == nil {
+			return 0, false, errMissingBaseFee
+		}
+		if tx.GasFeeCap().Cmp(tx.GasTipCap()) < 0 {
+			return 0, false, ErrTipAboveFeeCap
+		}
+		if tx.GasFeeCap().Cmp(baseFee) < 0 {
+			return 0, false, ErrFeeCapTooLow
+		}
+		msg = types.NewMessage(msg.From(), msg.To(), msg.Nonce(), msg.Value(), msg.Gas(), tx.EffectiveGasPrice(baseFee), msg.Data(), msg.CheckNonce())
+	}
+	payer := msg.From()
+	if tx.Type() == types.FeePayerTxType {
+		var err error
+		if payer, err = types.FeePayer(types.MakeTypedSigner(config, number), tx); err != nil {
+			return 0, false, err
+		}
+	}
+	listGas := tx.AccessListGas()
+	if listGas > 0 {
+		if msg.Gas() < listGas {
+			return 0, false, ErrIntrinsicGas
+		}
+		fee := new(big.Int).Mul(new(big.Int).SetUint64(listGas), msg.GasPrice())
+		if vmenv.StateDB.GetBalance(payer).Cmp(fee) < 0 {
+			return 0, false, errInsufficientBalanceForGas
+		}
+		if err := gp.SubGas(listGas); err != nil {
+			return 0, false, err
+		}
+		vmenv.StateDB.SubBalance(payer, fee)
+		vmenv.StateDB.AddBalance(vmenv.Coinbase, fee)
+
+		msg = types.NewMessage(msg.From(), msg.To(), msg.Nonce(), msg.Value(), msg.Gas()-listGas, msg.GasPrice(), msg.Data(), msg.CheckNonce())
+	}
+	var prefund *big.Int
+	if payer != msg.From() {
+		prefund = new(big.Int).Mul(new(big.Int).SetUint64(msg.Gas()), msg.GasPrice())
+		if vmenv.StateDB.GetBalance(payer).Cmp(prefund) < 0 {
+			gp.AddGas(listGas)
+			return 0, false, ErrInsufficientFeePayerFunds
+		}
+		vmenv.StateDB.SubBalance(payer, prefund)
+		vmenv.StateDB.AddBalance(msg.From(), prefund)
+	}
+	_, gas, failed, err := ApplyMessage(vmenv, msg, gp)
+	if err != nil {
+		gp.AddGas(listGas)
+		return 0, false, err
+	}
+	if prefund != nil {
+		refund := new(big.Int).Mul(new(big.Int).SetUint64(msg.Gas()-gas), msg.GasPrice())
+		vmenv.StateDB.SubBalance(msg.From(), refund)
+		vmenv.StateDB.AddBalance(payer, refund)
+	}
+	gas += listGas
+
+	if dynamicFee && baseFee.Sign() > 0 {
+		burnt := new(big.Int).Mul(new(big.Int).SetUint64(gas), baseFee)
+		vmenv.StateDB.SubBalance(vmenv.Coinbase, burnt)
+	}
+	return gas, failed, nil
+}
@@ -0,0 +1,71 @@
+package chain_core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+func TestApplyAccessListGas(t *testing.T) {
+	var (
+		config   = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), AccessListBlock: big.NewInt(0)}
+		signer   = types.MakeTypedSigner(config, big.NewInt(1))
+		coinbase = chain_common.Address{0xaa}
+		to       = chain_common.Address{0x01}
+		key, _   = crypto.GenerateKey()
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		header   = &types.Header{Number: big.NewInt(1), GasLimit: 8000000, Coinbase: coinbase}
+		chain    = &testChainContext{engine: &testEngine{}}
+		list     = types.AccessList{
+			{Address: chain_common.Address{0x02}, StorageKeys: []chain_common.Hash{{0x01}, {0x02}}},
+			{Address: chain_common.Address{0x03}},
+		}
+		listGas = 2*configs.TxAccessListAddressGas + 2*configs.TxAccessListStorageKeyGas
+	)
+	sign := func(tx *types.Transaction) *types.Transaction {
+		signed, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		return signed
+	}
+	statedb := newParallelTestState(t, chain_common.Address{0xcc}, sender)
+
+	tests := []struct {
+		tx  *types.Transaction
+		gas uint64
+	}{
+		{sign(types.NewAccessListTransaction(config.ChainID, 0, &to, big.NewInt(1), 100000, big.NewInt(1), nil, nil)), 21000},
+		{sign(types.NewAccessListTransaction(config.ChainID, 1, &to, big.NewInt(1), 100000, big.NewInt(1), nil, list)), 21000 + listGas},
+	}
+	for i, test := range tests {
+		gp := new(GasPool).AddGas(header.GasLimit)
+		before := statedb.GetBalance(coinbase)
+
+		receipt, gas, err := applyTransaction(config, chain, nil, gp, statedb, statedb, header, test.tx, nil, new(uint64), vm.Config{})
+		if err != nil {
+			t.Fatalf("测试 %d: 执行失败: %v", i, err)
+		}
+		if gas != test.gas || receipt.GasUsed != test.gas {
+			t.Errorf("测试 %d: 使用的gas不匹配: 得到 %d, 需要 %d", i, gas, test.gas)
+		}
+		if have := gp.Gas(); have != header.GasLimit-test.gas {
+			t.Errorf("测试 %d: gas 池剩余不匹配: 得到 %d, 需要 %d", i, have, header.GasLimit-test.gas)
+		}
+		if have := new(big.Int).Sub(statedb.GetBalance(coinbase), before); have.Uint64() != test.gas {
+			t.Errorf("测试 %d: coinbase 收到的费用不匹配: 得到 %v, 需要 %d", i, have, test.gas)
+		}
+	}
+	// gas 限制不足以支付访问列表的交易不能执行
+	low := sign(types.NewAccessListTransaction(config.ChainID, 2, &to, big.NewInt(1), listGas-1, big.NewInt(1), nil, list))
+	_, _, err := applyTransaction(config, chain, nil, new(GasPool).AddGas(header.GasLimit), statedb, statedb, header, low, nil, new(uint64), vm.Config{})
+	if !errors.Is(err, ErrIntrinsicGas) {
+		t.Errorf("访问列表的gas不足: 得到 %v, 需要 %v", err, ErrIntrinsicGas)
+	}
+}
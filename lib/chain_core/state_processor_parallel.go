@@ -0,0 +1,306 @@
+package chain_core
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/logger"
+	"github.com/aidoc/go-aidoc/lib/state"
+)
+
+// accessKind 区分被记录的状态访问的粒度。
+type accessKind uint8
+
+const (
+	accountAccess   accessKind = iota // 账户的余额、nonce、代码或存在性
+	storageAccess                     // 账户的单个存储槽
+	lifecycleAccess                   // 账户的创建或自毁（会清空全部存储）
+)
+
+// accessKey 标识一次状态访问。
+type accessKey struct {
+	kind accessKind
+	addr chain_common.Address
+	slot chain_common.Hash
+}
+
+// accessRecorder 包装一个状态数据库，记录交易执行期间的读集合和写集合，并把所有修改记录为
+// 可以在另一个状态数据库上重放的操作。 重放只在读集合未被之前的交易写入时才是正确的。
+type accessRecorder struct {
+	*state.StateDB
+
+	reads     map[accessKey]struct{}
+	writes    map[accessKey]struct{}
+	ops       []func(*state.StateDB) // 按执行顺序记录的修改操作
+	snapshots map[int]int            // 快照编号到当时 ops 长度的映射
+
+	changes map[chain_common.Address]*AccountChange // 被修改账户的修改前取值（仅在跟踪时记录）
+}
+
+// newAccessRecorder 创建一个包装 statedb 的访问记录器。
+func newAccessRecorder(statedb *state.StateDB) *accessRecorder {
+	return &accessRecorder{
+		StateDB:   statedb,
+		reads:     make(map[accessKey]struct{}),
+		writes:    make(map[accessKey]struct{}),
+		snapshots: make(map[int]int),
+	}
+}
+
+func (r *accessRecorder) read(kind accessKind, addr chain_common.Address, slot chain_common.Hash) {
+	r.reads[accessKey{kind, addr, slot}] = struct{}{}
+}
+
+func (r *accessRecorder) write(kind accessKind, addr chain_common.Address, slot chain_common.Hash, op func(*state.StateDB)) {
+	r.writes[accessKey{kind, addr, slot}] = struct{}{}
+	if r.changes != nil {
+		r.capture(kind, addr, slot)
+	}
+	if op != nil {
+		r.ops = append(r.ops, op)
+	}
+}
+
+func (r *accessRecorder) GetBalance(addr chain_common.Address) *big.Int {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	return r.StateDB.GetBalance(addr)
+}
+
+func (r *accessRecorder) GetNonce(addr chain_common.Address) uint64 {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	return r.StateDB.GetNonce(addr)
+}
+
+func (r *accessRecorder) GetCode(addr chain_common.Address) []byte {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	return r.StateDB.GetCode(addr)
+}
+
+func (r *accessRecorder) GetCodeHash(addr chain_common.Address) chain_common.Hash {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	return r.StateDB.GetCodeHash(addr)
+}
+
+func (r *accessRecorder) GetCodeSize(addr chain_common.Address) int {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	return r.StateDB.GetCodeSize(addr)
+}
+
+func (r *accessRecorder) Exist(addr chain_common.Address) bool {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	return r.StateDB.Exist(addr)
+}
+
+func (r *accessRecorder) Empty(addr chain_common.Address) bool {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	return r.StateDB.Empty(addr)
+}
+
+func (r *accessRecorder) HasSuicided(addr chain_common.Address) bool {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	return r.StateDB.HasSuicided(addr)
+}
+
+func (r *accessRecorder) GetState(addr chain_common.Address, key chain_common.Hash) chain_common.Hash {
+	r.read(storageAccess, addr, key)
+	r.read(lifecycleAccess, addr, chain_common.Hash{})
+	return r.StateDB.GetState(addr, key)
+}
+
+func (r *accessRecorder) CreateAccount(addr chain_common.Address) {
+	// 创建账户会保留原有余额，因此同时也是一次读取
+	r.read(accountAccess, addr, chain_common.Hash{})
+	r.write(accountAccess, addr, chain_common.Hash{}, nil)
+	r.write(lifecycleAccess, addr, chain_common.Hash{}, func(db *state.StateDB) { db.CreateAccount(addr) })
+	r.StateDB.CreateAccount(addr)
+}
+
+func (r *accessRecorder) AddBalance(addr chain_common.Address, amount *big.Int) {
+	// 余额增加是可交换的，重放增量即可，不构成读取
+	delta := new(big.Int).Set(amount)
+	r.write(accountAccess, addr, chain_common.Hash{}, func(db *state.StateDB) { db.AddBalance(addr, delta) })
+	r.StateDB.AddBalance(addr, amount)
+}
+
+func (r *accessRecorder) SubBalance(addr chain_common.Address, amount *big.Int) {
+	delta := new(big.Int).Set(amount)
+	r.write(accountAccess, addr, chain_common.Hash{}, func(db *state.StateDB) { db.SubBalance(addr, delta) })
+	r.StateDB.SubBalance(addr, amount)
+}
+
+func (r *accessRecorder) SetNonce(addr chain_common.Address, nonce uint64) {
+	r.write(accountAccess, addr, chain_common.Hash{}, func(db *state.StateDB) { db.SetNonce(addr, nonce) })
+	r.StateDB.SetNonce(addr, nonce)
+}
+
+func (r *accessRecorder) SetCode(addr chain_common.Address, code []byte) {
+	code = chain_common.CopyBytes(code)
+	r.write(accountAccess, addr, chain_common.Hash{}, func(db *state.StateDB) { db.SetCode(addr, code) })
+	r.StateDB.SetCode(addr, code)
+}
+
+func (r *accessRecorder) SetState(addr chain_common.Address, key, value chain_common.Hash) {
+	r.write(storageAccess, addr, key, func(db *state.StateDB) { db.SetState(addr, key, value) })
+	r.StateDB.SetState(addr, key, value)
+}
+
+func (r *accessRecorder) Suicide(addr chain_common.Address) bool {
+	r.read(accountAccess, addr, chain_common.Hash{})
+	r.write(accountAccess, addr, chain_common.Hash{}, nil)
+	r.write(lifecycleAccess, addr, chain_common.Hash{}, func(db *state.StateDB) { db.Suicide(addr) })
+	return r.StateDB.Suicide(addr)
+}
+
+func (r *accessRecorder) AddLog(log *types.Log) {
+	// 交易哈希和日志索引由重放时的状态数据库重新填写
+	address, topics, data, number := log.Address, log.Topics, log.Data, log.BlockNumber
+	r.ops = append(r.ops, func(db *state.StateDB) {
+		db.AddLog(&types.Log{Address: address, Topics: topics, Data: data, BlockNumber: number})
+	})
+	r.StateDB.AddLog(log)
+}
+
+func (r *accessRecorder) AddPreimage(hash chain_common.Hash, preimage []byte) {
+	preimage = chain_common.CopyBytes(preimage)
+	r.ops = append(r.ops, func(db *state.StateDB) { db.AddPreimage(hash, preimage) })
+	r.StateDB.AddPreimage(hash, preimage)
+}
+
+func (r *accessRecorder) Snapshot() int {
+	id := r.StateDB.Snapshot()
+	r.snapshots[id] = len(r.ops)
+	return id
+}
+
+func (r *accessRecorder) RevertToSnapshot(id int) {
+	// 读写集合保持不变（保守），只丢弃被撤销的修改操作
+	if n, ok := r.snapshots[id]; ok {
+		r.ops = r.ops[:n]
+	}
+	r.StateDB.RevertToSnapshot(id)
+}
+
+// conflicts 返回记录的读集合是否与给定的写集合相交。
+func (r *accessRecorder) conflicts(written map[accessKey]struct{}) bool {
+	for key := range r.reads {
+		if _, ok := written[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// speculativeResult 是一笔交易在区块起始状态副本上推测执行的结果。
+type speculativeResult struct {
+	recorder *accessRecorder
+	from     chain_common.Address
+	gas      uint64
+	failed   bool
+	err      error
+}
+
+// processParallel 在 workers 个协程上针对区块起始状态推测执行所有交易并记录读写集合，然后按区块顺序
+// 提交：读集合未被之前交易写入的结果直接在 statedb 上重放，其余交易在 statedb 上重新串行执行。
+// 因此收据、日志和使用的gas与串行执行完全相同。
+//
+// 每个工作协程只持有一个区块起始状态的副本，每笔交易执行前创建快照、执行后撤销，使每笔交易都
+// 看到相同的起始状态。
+func (p *StateProcessor) processParallel(block *types.Block, chain ChainContext, statedb *state.StateDB, gp *GasPool, baseFee *big.Int, usedGas *uint64, cfg vm.Config) (types.Receipts, []*types.Log, error) {
+	var (
+		txs     = block.Transactions()
+		header  = block.Header()
+		signer  = types.MakeTypedSigner(p.config, header.Number)
+		results = make([]*speculativeResult, len(txs))
+		tasks   = make(chan int, len(txs))
+		pend    sync.WaitGroup
+	)
+	for i := range txs {
+		tasks <- i
+	}
+	close(tasks)
+
+	workers := p.parallel
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+	for w := 0; w < workers; w++ {
+		// 状态副本必须在任何交易修改 statedb 之前创建
+		workerdb := statedb.Copy()
+
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+			for i := range tasks {
+				snapshot := workerdb.Snapshot()
+				results[i] = p.speculate(block, chain, header, signer, baseFee, workerdb, txs[i], i, cfg)
+				workerdb.RevertToSnapshot(snapshot)
+			}
+		}()
+	}
+	pend.Wait()
+
+	var (
+		receipts types.Receipts
+		allLogs  []*types.Log
+		written  = make(map[accessKey]struct{})
+		reruns   int
+	)
+	for i, tx := range txs {
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+
+		res := results[i]
+		var receipt *types.Receipt
+		if res.err == nil && gp.Gas() >= tx.Gas() && !res.recorder.conflicts(written) {
+			// 推测结果有效，在真实状态上重放修改
+			for _, op := range res.recorder.ops {
+				op(statedb)
+			}
+			if err := gp.SubGas(res.gas); err != nil {
+				return nil, nil, withTxIndex(newTxError(tx, err), i)
+			}
+			receipt = newTransactionReceipt(p.config, statedb, header, tx, res.from, res.gas, res.failed, usedGas)
+		} else {
+			// 推测结果可能已过时，按顺序重新执行并记录真实的写集合
+			reruns++
+			recorder := newAccessRecorder(statedb)
+
+			var err error
+			if receipt, _, err = applyTransaction(p.config, chain, nil, gp, statedb, recorder, header, tx, baseFee, usedGas, cfg); err != nil {
+				return nil, nil, withTxIndex(err, i)
+			}
+			res.recorder = recorder
+		}
+		for key := range res.recorder.writes {
+			written[key] = struct{}{}
+		}
+		results[i] = nil
+
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	logger.Debug("并行执行区块交易", "number", block.Number(), "txs", len(txs), "reruns", reruns)
+
+	return receipts, allLogs, nil
+}
+
+// speculate 在给定的状态副本上执行一笔交易，不检查区块 gas 池。 调用者负责撤销交易对副本的修改。
+func (p *StateProcessor) speculate(block *types.Block, chain ChainContext, header *types.Header, signer types.Signer, baseFee *big.Int, statedb *state.StateDB, tx *types.Transaction, index int, cfg vm.Config) *speculativeResult {
+	statedb.Prepare(tx.Hash(), block.Hash(), index)
+
+	res := &speculativeResult{recorder: newAccessRecorder(statedb)}
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.from = msg.From()
+
+	vmenv := vm.NewEVM(NewEVMContext(msg, header, chain, nil), res.recorder, p.config, cfg)
+	res.gas, res.failed, res.err = applyTypedMessage(vmenv, tx, msg, new(GasPool).AddGas(header.GasLimit), baseFee)
+
+	return res
+}
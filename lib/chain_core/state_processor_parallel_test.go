@@ -0,0 +1,138 @@
+package chain_core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/state"
+	"github.com/aidoc/go-aidoc/service/db_model"
+	"github.com/aidoc/go-aidoc/service/produce/consensus"
+)
+
+// testChainContext 是只提供共识引擎的链上下文，不存在任何祖先区块头。
+type testChainContext struct {
+	engine consensus.Engine
+}
+
+func (c *testChainContext) Engine() consensus.Engine { return c.engine }
+
+func (c *testChainContext) GetHeader(chain_common.Hash, uint64) *types.Header { return nil }
+
+// counterCode 每次被调用时把存储槽 0 加一并输出一条日志。
+var counterCode = []byte{
+	0x60, 0x00, 0x54, // SLOAD(0)
+	0x60, 0x01, 0x01, // ADD(1)
+	0x60, 0x00, 0x55, // SSTORE(0)
+	0x60, 0x00, 0x60, 0x00, 0xa0, // LOG0(0, 0)
+	0x00, // STOP
+}
+
+// newParallelTestState 创建一个包含 funded 账户余额和计数合约的状态。
+func newParallelTestState(t *testing.T, counter chain_common.Address, funded ...chain_common.Address) *state.StateDB {
+	statedb, err := state.New(chain_common.Hash{}, state.NewDatabase(db_model.NewMemDatabase()))
+	if err != nil {
+		t.Fatalf("无法创建状态: %v", err)
+	}
+	for _, addr := range funded {
+		statedb.AddBalance(addr, big.NewInt(1000000000))
+	}
+	statedb.SetCode(counter, counterCode)
+	statedb.IntermediateRoot(false)
+	return statedb
+}
+
+func TestProcessParallelMatchesSerial(t *testing.T) {
+	var (
+		config  = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), ReceiptRootBlock: big.NewInt(0)}
+		signer  = types.MakeSigner(config, big.NewInt(1))
+		counter = chain_common.Address{0xcc}
+		keys    = make([]*ecdsa.PrivateKey, 4)
+		addrs   = make([]chain_common.Address, len(keys))
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	fresh, _ := crypto.GenerateKey()
+	freshAddr := crypto.PubkeyToAddress(fresh.PublicKey)
+
+	nonces := make(map[*ecdsa.PrivateKey]uint64)
+	sign := func(key *ecdsa.PrivateKey, to chain_common.Address, value int64, gas uint64) *types.Transaction {
+		tx := types.NewTransaction(nonces[key], to, big.NewInt(value), gas, big.NewInt(1), nil)
+		nonces[key]++
+
+		signed, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		return signed
+	}
+	txs := types.Transactions{
+		// 互不相关的转账
+		sign(keys[0], chain_common.Address{0x01}, 1, 21000),
+		sign(keys[1], chain_common.Address{0x02}, 1, 21000),
+		// 同一发送者的连续 nonce
+		sign(keys[0], chain_common.Address{0x03}, 1, 21000),
+		// 给新账户转账，然后由新账户花费
+		sign(keys[2], freshAddr, 100000000, 21000),
+		sign(fresh, chain_common.Address{0x04}, 1, 21000),
+		// 不同发送者调用同一个计数合约
+		sign(keys[1], counter, 0, 100000),
+		sign(keys[3], counter, 0, 100000),
+		sign(keys[2], counter, 0, 100000),
+	}
+	block := types.NewBlockWithHeader(&types.Header{
+		Number:   big.NewInt(1),
+		GasLimit: 8000000,
+		Coinbase: chain_common.Address{0xaa},
+	}).WithBody(txs, nil)
+
+	chain := &testChainContext{engine: &testEngine{}}
+	run := func(parallel int) (types.Receipts, []*types.Log, uint64, chain_common.Hash) {
+		var (
+			statedb = newParallelTestState(t, counter, addrs...)
+			p       = &StateProcessor{config: config, parallel: parallel}
+			gp      = new(GasPool).AddGas(block.GasLimit())
+			usedGas = new(uint64)
+
+			receipts types.Receipts
+			logs     []*types.Log
+			err      error
+		)
+		if parallel > 1 {
+			receipts, logs, err = p.processParallel(block, chain, statedb, gp, nil, usedGas, vm.Config{})
+		} else {
+			receipts, logs, err = p.processSerial(block, chain, statedb, gp, nil, usedGas, vm.Config{})
+		}
+		if err != nil {
+			t.Fatalf("执行失败 (parallel %d): %v", parallel, err)
+		}
+		return receipts, logs, *usedGas, statedb.IntermediateRoot(true)
+	}
+	wantReceipts, wantLogs, wantGas, wantRoot := run(1)
+	if len(wantLogs) != 3 {
+		t.Fatalf("串行执行的日志数量不匹配: 得到 %d, 需要 3", len(wantLogs))
+	}
+	for _, workers := range []int{2, 3, len(txs)} {
+		receipts, logs, gas, root := run(workers)
+		if !reflect.DeepEqual(receipts, wantReceipts) {
+			t.Errorf("workers %d: 收据不匹配", workers)
+		}
+		if !reflect.DeepEqual(logs, wantLogs) {
+			t.Errorf("workers %d: 日志不匹配", workers)
+		}
+		if gas != wantGas {
+			t.Errorf("workers %d: 使用的gas不匹配: 得到 %d, 需要 %d", workers, gas, wantGas)
+		}
+		if root != wantRoot {
+			t.Errorf("workers %d: 状态根不匹配: 得到 %x, 需要 %x", workers, root, wantRoot)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package chain_core
+
+import (
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/state"
+	"github.com/aidoc/go-aidoc/service/produce/consensus"
+)
+
+// rewardEngine 包装一个共识引擎，用链配置中的奖励计划替换引擎自身的区块奖励。
+type rewardEngine struct {
+	consensus.Engine
+	config *configs.ChainConfig
+}
+
+// WithRewardSchedule 返回在 Finalize 中按 config.Reward 发放区块奖励并分配交易费的共识引擎，
+// 未配置 Reward 时原样返回 engine。 区块导入和区块打包必须使用同一个包装后的引擎，否则双方计算的
+// 状态根不一致。 NewStateProcessor 和 NewHeaderChain 都会包装传入的引擎，打包区块时应使用
+// HeaderChain.Engine 返回的引擎。
+func WithRewardSchedule(config *configs.ChainConfig, engine consensus.Engine) consensus.Engine {
+	if config.Reward == nil {
+		return engine
+	}
+	if _, ok := engine.(*rewardEngine); ok {
+		return engine
+	}
+	return &rewardEngine{Engine: engine, config: config}
+}
+
+// Finalize 按奖励计划发放奖励并分配交易费，然后计算状态根并组装区块。 它不调用被包装引擎的
+// Finalize，因此引擎自身的区块奖励不会发放。
+func (e *rewardEngine) Finalize(chain consensus.ChainReader, header *types.Header, statedb *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*types.Block, error) {
+	var baseFee *big.Int
+	if e.config.IsDynamicFee(header.Number) {
+		if baseFee = chainBaseFee(e.config, chain, header); baseFee == nil {
+			return nil, errMissingBaseFee
+		}
+	}
+	applyRewardSchedule(e.config, header, statedb, txs, receipts, baseFee)
+
+	header.Root = statedb.IntermediateRoot(true)
+	return types.NewBlock(header, txs, nil, receipts), nil
+}
+
+// applyRewardSchedule 按链配置中的 Reward 规则分配交易费并发放区块奖励。 未配置 Reward 时不做任何修改。
+//
+// 交易执行时交易费（动态费用分叉之后只有小费部分）已经计入 coinbase，这里从 coinbase 扣除国库和销毁的份额，
+// 并把国库份额转给国库地址。 coinbase 可能在同一区块的后续交易中花掉了收到的交易费，因此扣除的份额
+// 不超过它的余额，不足的部分先从销毁份额中减去。 baseFee 是区块的基础费用，分叉之前为 nil。
+func applyRewardSchedule(config *configs.ChainConfig, header *types.Header, statedb *state.StateDB, txs types.Transactions, receipts types.Receipts, baseFee *big.Int) {
+	if config.Reward == nil {
+		return
+	}
+	_, treasury, burnt := config.Reward.SplitFees(blockFees(txs, receipts, baseFee))
+
+	cut := new(big.Int).Add(treasury, burnt)
+	if balance := statedb.GetBalance(header.Coinbase); cut.Cmp(balance) > 0 {
+		cut.Set(balance)
+		if treasury.Cmp(cut) > 0 {
+			treasury.Set(cut)
+		}
+	}
+	if cut.Sign() > 0 {
+		statedb.SubBalance(header.Coinbase, cut)
+	}
+	if treasury.Sign() > 0 {
+		statedb.AddBalance(config.Reward.Treasury, treasury)
+	}
+	if reward := config.Reward.BlockReward(header.Number); reward.Sign() > 0 {
+		statedb.AddBalance(header.Coinbase, reward)
+	}
+}
+
+// rewardRecipients 返回 Finalize 步骤中余额可能变化的账户。
+func rewardRecipients(config *configs.ChainConfig, header *types.Header) []chain_common.Address {
+	recipients := []chain_common.Address{header.Coinbase}
+	if config.Reward != nil && config.Reward.TreasuryShare > 0 && config.Reward.Treasury != header.Coinbase {
+		recipients = append(recipients, config.Reward.Treasury)
+	}
+	return recipients
+}
+
+// blockFees 返回区块中所有交易支付给 coinbase 的交易费总额，不包括已销毁的基础费用。
+func blockFees(txs types.Transactions, receipts types.Receipts, baseFee *big.Int) *big.Int {
+	fees := new(big.Int)
+	for i, receipt := range receipts {
+		fee := new(big.Int).SetUint64(receipt.GasUsed)
+		fees.Add(fees, fee.Mul(fee, txs[i].EffectiveGasTip(baseFee)))
+	}
+	return fees
+}
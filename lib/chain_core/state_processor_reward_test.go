@@ -0,0 +1,157 @@
+package chain_core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+func TestRewardSchedule(t *testing.T) {
+	var (
+		coinbase = chain_common.Address{0xaa}
+		treasury = chain_common.Address{0xee}
+		counter  = chain_common.Address{0xcc}
+		config   = &configs.ChainConfig{
+			ChainID:        big.NewInt(1),
+			HomesteadBlock: big.NewInt(0),
+			Reward: &configs.RewardConfig{
+				Schedule: []configs.RewardEra{
+					{Block: big.NewInt(10), Reward: big.NewInt(100)},
+					{Block: big.NewInt(20), Reward: big.NewInt(50)},
+				},
+				Treasury:      treasury,
+				TreasuryShare: 2000,
+				BurnShare:     3000,
+			},
+		}
+		// 被包装引擎自身的奖励不应发放
+		inner  = &testRewardEngine{reward: big.NewInt(5000)}
+		engine = WithRewardSchedule(config, inner)
+
+		// 每笔交易支付 100 gas * 10 = 1000 交易费：国库 200，销毁 300
+		tx      = types.NewTransaction(0, chain_common.Address{0x01}, big.NewInt(0), 21000, big.NewInt(10), nil)
+		receipt = &types.Receipt{GasUsed: 100}
+	)
+	tests := []struct {
+		name     string
+		number   int64
+		txs      int
+		balance  int64 // Finalize 之前 coinbase 的余额，即已收到的交易费
+		coinbase int64
+		treasury int64
+	}{
+		{"第一个阶段之前没有发行", 5, 1, 1000, 500, 200},
+		{"第一个阶段", 10, 1, 1000, 600, 200},
+		{"第二个阶段", 25, 1, 1000, 550, 200},
+		{"没有交易时只发行奖励", 10, 0, 0, 100, 0},
+		{"多笔交易的交易费合计分配", 10, 3, 3000, 1600, 600},
+		{"coinbase 花掉部分交易费时先减少销毁", 25, 1, 400, 50, 200},
+		{"coinbase 余额不足国库份额", 25, 1, 100, 50, 100},
+		{"coinbase 余额为零", 25, 1, 0, 50, 0},
+	}
+	for _, test := range tests {
+		var (
+			statedb  = newParallelTestState(t, counter)
+			header   = &types.Header{Number: big.NewInt(test.number), Coinbase: coinbase}
+			txs      []*types.Transaction
+			receipts []*types.Receipt
+		)
+		for i := 0; i < test.txs; i++ {
+			txs, receipts = append(txs, tx), append(receipts, receipt)
+		}
+		statedb.AddBalance(coinbase, big.NewInt(test.balance))
+
+		block, err := engine.Finalize(nil, header, statedb, txs, receipts)
+		if err != nil {
+			t.Errorf("%s: Finalize 失败: %v", test.name, err)
+			continue
+		}
+		if block == nil || block.Root() != statedb.IntermediateRoot(true) {
+			t.Errorf("%s: 区块的状态根不匹配", test.name)
+		}
+		if got := statedb.GetBalance(coinbase); got.Cmp(big.NewInt(test.coinbase)) != 0 {
+			t.Errorf("%s: coinbase 余额不匹配: 得到 %v, 需要 %d", test.name, got, test.coinbase)
+		}
+		if got := statedb.GetBalance(treasury); got.Cmp(big.NewInt(test.treasury)) != 0 {
+			t.Errorf("%s: 国库余额不匹配: 得到 %v, 需要 %d", test.name, got, test.treasury)
+		}
+	}
+}
+
+func TestWithRewardSchedule(t *testing.T) {
+	inner := &testRewardEngine{reward: big.NewInt(5000)}
+
+	// 没有奖励计划时使用引擎自身的 Finalize
+	if engine := WithRewardSchedule(configs.TestChainConfig, inner); engine != inner {
+		t.Errorf("没有奖励计划时引擎被包装")
+	}
+	config := *configs.TestChainConfig
+	config.Reward = &configs.RewardConfig{}
+
+	engine := WithRewardSchedule(&config, inner)
+	if engine == inner {
+		t.Fatalf("配置了奖励计划时引擎没有被包装")
+	}
+	if WithRewardSchedule(&config, engine) != engine {
+		t.Errorf("引擎被重复包装")
+	}
+}
+
+func TestProcessRewardSchedule(t *testing.T) {
+	var (
+		coinbase = chain_common.Address{0xaa}
+		treasury = chain_common.Address{0xee}
+		counter  = chain_common.Address{0xcc}
+		config   = &configs.ChainConfig{
+			ChainID:        big.NewInt(1),
+			HomesteadBlock: big.NewInt(0),
+			Reward: &configs.RewardConfig{
+				Schedule:      []configs.RewardEra{{Block: big.NewInt(0), Reward: big.NewInt(100)}},
+				Treasury:      treasury,
+				TreasuryShare: 2000,
+				BurnShare:     3000,
+			},
+		}
+		signer = types.MakeSigner(config, big.NewInt(1))
+		key, _ = crypto.GenerateKey()
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	tx, err := types.SignTx(types.NewTransaction(0, chain_common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(10), nil), signer, key)
+	if err != nil {
+		t.Fatalf("无法签名交易: %v", err)
+	}
+	block := types.NewBlockWithHeader(&types.Header{
+		Number:   big.NewInt(1),
+		GasLimit: 8000000,
+		Coinbase: coinbase,
+	}).WithBody(types.Transactions{tx}, nil)
+
+	hc, err := NewHeaderChain(newTestGenesisDatabase(), config, &testEngine{}, func() bool { return false })
+	if err != nil {
+		t.Fatalf("无法创建区块头链: %v", err)
+	}
+	// 区块头链返回包装后的引擎供区块打包使用
+	if _, ok := hc.Engine().(*rewardEngine); !ok {
+		t.Errorf("区块头链的引擎没有被包装")
+	}
+	// 处理器同样包装传入的引擎，引擎自身的奖励不发放
+	var (
+		p       = NewStateProcessor(config, &BlockChain{hc: hc}, &testRewardEngine{reward: big.NewInt(5000)})
+		statedb = newParallelTestState(t, counter, sender)
+	)
+	if _, _, _, err := p.Process(block, statedb, vm.Config{}); err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	// 交易费 21000 * 10 = 210000：国库 42000，销毁 63000，coinbase 留下其余部分并获得区块奖励 100
+	if got := statedb.GetBalance(coinbase); got.Cmp(big.NewInt(105100)) != 0 {
+		t.Errorf("coinbase 余额不匹配: 得到 %v, 需要 %d", got, 105100)
+	}
+	if got := statedb.GetBalance(treasury); got.Cmp(big.NewInt(42000)) != 0 {
+		t.Errorf("国库余额不匹配: 得到 %v, 需要 %d", got, 42000)
+	}
+}
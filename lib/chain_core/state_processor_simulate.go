@@ -0,0 +1,114 @@
+package chain_core
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/state"
+	"github.com/aidoc/go-aidoc/service/produce/consensus"
+)
+
+// SimulatedTx 是交给 Simulate 执行的一笔交易。 From 为 nil 时交易必须已签名，发送者从签名恢复；
+// 否则交易可以未签名，直接以 From 作为发送者执行，并且不检查 nonce。
+type SimulatedTx struct {
+	Tx   *types.Transaction
+	From *chain_common.Address
+}
+
+// SimulationResult 是 Simulate 的执行结果。
+type SimulationResult struct {
+	Header   *types.Header    // 模拟执行使用的候选区块头
+	Receipts types.Receipts   // 每笔交易的收据
+	Logs     []*types.Log     // 所有交易产生的日志
+	GasUsed  uint64           // 所有交易使用的gas总量
+	Accounts []*AccountChange // 整批交易对状态的净修改，按地址排序
+}
+
+// Simulate 在父区块状态的一次性副本上按顺序执行一批交易，就像它们被打包进父区块之后的下一个区块，
+// 并返回收据、日志、使用的gas以及状态差异。 后面的交易可以依赖前面交易的结果。
+//
+// 模拟执行不会提交状态，也不会向数据库写入任何内容。 共识引擎的 Finalize 步骤（区块奖励）不会执行，
+// 因此状态差异只包含交易本身的影响。 任何交易无法执行时返回错误，不返回部分结果。
+func (p *StateProcessor) Simulate(parentHash chain_common.Hash, txs []*SimulatedTx, cfg vm.Config) (*SimulationResult, error) {
+	parent := p.bc.GetHeaderByHash(parentHash)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := p.bc.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	return p.simulate(p.bc, p.simulatedHeader(parent), statedb, txs, cfg)
+}
+
+// simulate 在 statedb 上把 txs 作为区块 header 中的交易执行。 交易与区块处理使用相同的执行路径，
+// 只有 From 覆盖的交易使用不检查 nonce 的消息。
+func (p *StateProcessor) simulate(chain ChainContext, header *types.Header, statedb *state.StateDB, txs []*SimulatedTx, cfg vm.Config) (*SimulationResult, error) {
+	var (
+		signer   = types.MakeTypedSigner(p.config, header.Number)
+		baseFee  = chainBaseFee(p.config, chain, header)
+		gp       = new(GasPool).AddGas(header.GasLimit)
+		usedGas  = new(uint64)
+		recorder = newAccessRecorder(statedb)
+		result   = &SimulationResult{Header: header}
+	)
+	// 所有交易共享一个记录器，状态差异是整批交易的净影响
+	recorder.changes = make(map[chain_common.Address]*AccountChange)
+
+	for i, stx := range txs {
+		// 未签名的相同交易哈希相同，日志按每笔交易的序号生成的哈希记录，避免不同交易的日志混在一起
+		tx, key := stx.Tx, simulatedTxKey(stx.Tx, i)
+		statedb.Prepare(key, chain_common.Hash{}, i)
+
+		var (
+			msg types.Message
+			err error
+		)
+		if stx.From != nil {
+			msg = types.NewMessage(*stx.From, tx.To(), tx.Nonce(), tx.Value(), tx.Gas(), tx.GasPrice(), tx.Data(), false)
+		} else if msg, err = tx.AsMessage(signer); err != nil {
+			return nil, withTxIndex(newTxError(tx, err), i)
+		}
+		receipt, _, err := applyTransactionMessage(p.config, chain, nil, gp, statedb, recorder, header, tx, msg, baseFee, usedGas, cfg)
+		if err != nil {
+			return nil, withTxIndex(err, i)
+		}
+		receipt.Logs = statedb.GetLogs(key)
+		for _, log := range receipt.Logs {
+			log.TxHash = tx.Hash()
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+		result.Receipts = append(result.Receipts, receipt)
+		result.Logs = append(result.Logs, receipt.Logs...)
+	}
+	result.GasUsed = *usedGas
+	result.Accounts = recorder.accountChanges()
+
+	return result, nil
+}
+
+// simulatedTxKey 返回模拟执行中第 index 笔交易记录日志使用的哈希。
+func simulatedTxKey(tx *types.Transaction, index int) chain_common.Hash {
+	return crypto.Keccak256Hash(tx.Hash().Bytes(), big.NewInt(int64(index)).Bytes())
+}
+
+// simulatedHeader 构造父区块之后的候选区块头，时间戳取当前时间但至少比父区块晚一秒。
+func (p *StateProcessor) simulatedHeader(parent *types.Header) *types.Header {
+	timestamp := big.NewInt(time.Now().Unix())
+	if timestamp.Cmp(parent.Time) <= 0 {
+		timestamp = new(big.Int).Add(parent.Time, chain_common.Big1)
+	}
+	return &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, chain_common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       timestamp,
+		Coinbase:   parent.Coinbase,
+		Difficulty: p.engine.CalcDifficulty(p.bc, timestamp.Uint64(), parent),
+	}
+}
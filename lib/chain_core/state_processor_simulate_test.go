@@ -0,0 +1,137 @@
+package chain_core
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+func TestSimulateMatchesProcessing(t *testing.T) {
+	var (
+		config  = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), ReceiptRootBlock: big.NewInt(0)}
+		signer  = types.MakeSigner(config, big.NewInt(1))
+		counter = chain_common.Address{0xcc}
+		key, _  = crypto.GenerateKey()
+		sender  = crypto.PubkeyToAddress(key.PublicKey)
+		chain   = &testChainContext{engine: &testEngine{}}
+	)
+	var txs types.Transactions
+	for nonce, to := range []chain_common.Address{{0x01}, counter, counter} {
+		tx, err := types.SignTx(types.NewTransaction(uint64(nonce), to, big.NewInt(1), 100000, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		txs = append(txs, tx)
+	}
+	block := types.NewBlockWithHeader(&types.Header{
+		Number:   big.NewInt(1),
+		GasLimit: 8000000,
+		Coinbase: chain_common.Address{0xaa},
+	}).WithBody(txs, nil)
+
+	p := &StateProcessor{config: config}
+
+	statedb := newParallelTestState(t, counter, sender)
+	receipts, logs, err := p.processSerial(block, chain, statedb, new(GasPool).AddGas(block.GasLimit()), nil, new(uint64), vm.Config{})
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	simulated := make([]*SimulatedTx, len(txs))
+	for i, tx := range txs {
+		simulated[i] = &SimulatedTx{Tx: tx}
+	}
+	result, err := p.simulate(chain, block.Header(), newParallelTestState(t, counter, sender), simulated, vm.Config{})
+	if err != nil {
+		t.Fatalf("模拟执行失败: %v", err)
+	}
+	// 模拟执行的日志没有区块哈希，其余内容必须与区块处理完全相同
+	for _, log := range logs {
+		log.BlockHash = chain_common.Hash{}
+	}
+	if !reflect.DeepEqual(result.Receipts, receipts) {
+		t.Errorf("收据不匹配")
+	}
+	if !reflect.DeepEqual(result.Logs, logs) {
+		t.Errorf("日志不匹配")
+	}
+	if result.GasUsed != receipts[len(receipts)-1].CumulativeGasUsed {
+		t.Errorf("使用的gas不匹配: 得到 %d, 需要 %d", result.GasUsed, receipts[len(receipts)-1].CumulativeGasUsed)
+	}
+}
+
+func TestSimulateFromOverride(t *testing.T) {
+	var (
+		config  = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0)}
+		counter = chain_common.Address{0xcc}
+		funded  = chain_common.Address{0x11}
+		fresh   = chain_common.Address{0x22}
+		header  = &types.Header{Number: big.NewInt(1), GasLimit: 8000000, Coinbase: chain_common.Address{0xaa}}
+		p       = &StateProcessor{config: config}
+		chain   = &testChainContext{engine: &testEngine{}}
+	)
+	// 未签名的交易以覆盖的发送者执行，nonce 与账户状态不符也不影响执行，后一笔交易花费前一笔转入的资金
+	txs := []*SimulatedTx{
+		{Tx: types.NewTransaction(7, fresh, big.NewInt(50000000), 21000, big.NewInt(1), nil), From: &funded},
+		{Tx: types.NewTransaction(3, chain_common.Address{0x01}, big.NewInt(1000), 21000, big.NewInt(1), nil), From: &fresh},
+	}
+	result, err := p.simulate(chain, header, newParallelTestState(t, counter, funded), txs, vm.Config{})
+	if err != nil {
+		t.Fatalf("模拟执行失败: %v", err)
+	}
+	if len(result.Receipts) != 2 || result.GasUsed != 42000 {
+		t.Fatalf("结果不匹配: %d 个收据, 使用 %d gas", len(result.Receipts), result.GasUsed)
+	}
+	balances := make(map[chain_common.Address]*AccountChange)
+	for _, change := range result.Accounts {
+		balances[change.Address] = change
+	}
+	want := big.NewInt(50000000 - 1000 - 21000)
+	if change := balances[fresh]; change == nil || change.BalanceBefore.Sign() != 0 || change.BalanceAfter.Cmp(want) != 0 {
+		t.Errorf("新账户的变化不匹配: %+v", change)
+	}
+	// 余额不足的交易报告出错交易的序号
+	txs = append(txs, &SimulatedTx{Tx: types.NewTransaction(0, funded, big.NewInt(1), 21000, big.NewInt(1), nil), From: &chain_common.Address{0x33}})
+	_, err = p.simulate(chain, header, newParallelTestState(t, counter, funded), txs, vm.Config{})
+
+	var txErr *TxError
+	if !errors.As(err, &txErr) || txErr.Index != 2 {
+		t.Fatalf("需要第 2 笔交易的 *TxError, 得到 %v", err)
+	}
+}
+
+func TestSimulateIdenticalTxLogs(t *testing.T) {
+	var (
+		config  = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0)}
+		counter = chain_common.Address{0xcc}
+		funded  = chain_common.Address{0x11}
+		header  = &types.Header{Number: big.NewInt(1), GasLimit: 8000000, Coinbase: chain_common.Address{0xaa}}
+		p       = &StateProcessor{config: config}
+		chain   = &testChainContext{engine: &testEngine{}}
+		tx      = types.NewTransaction(0, counter, big.NewInt(0), 100000, big.NewInt(1), nil)
+	)
+	// 两笔完全相同的未签名交易哈希相同，每笔交易的收据只包含自己的日志
+	txs := []*SimulatedTx{{Tx: tx, From: &funded}, {Tx: tx, From: &funded}}
+	result, err := p.simulate(chain, header, newParallelTestState(t, counter, funded), txs, vm.Config{})
+	if err != nil {
+		t.Fatalf("模拟执行失败: %v", err)
+	}
+	if len(result.Logs) != 2 {
+		t.Fatalf("日志数量不匹配: 得到 %d, 需要 2", len(result.Logs))
+	}
+	for i, receipt := range result.Receipts {
+		if len(receipt.Logs) != 1 {
+			t.Errorf("收据 %d: 日志数量不匹配: 得到 %d, 需要 1", i, len(receipt.Logs))
+			continue
+		}
+		if log := receipt.Logs[0]; log.TxIndex != uint(i) || log.TxHash != tx.Hash() {
+			t.Errorf("收据 %d: 日志不匹配: 序号 %d, 哈希 %x", i, log.TxIndex, log.TxHash)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package chain_core
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+func TestReceiptRootBlock(t *testing.T) {
+	var (
+		config  = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), ReceiptRootBlock: big.NewInt(5)}
+		signer  = types.MakeSigner(config, big.NewInt(1))
+		chain   = &testChainContext{engine: &testEngine{}}
+		key, _  = crypto.GenerateKey()
+		sender  = crypto.PubkeyToAddress(key.PublicKey)
+		counter = chain_common.Address{0xcc}
+		statedb = newParallelTestState(t, counter, sender)
+	)
+	for nonce, number := range []int64{4, 5, 6} {
+		tx, err := types.SignTx(types.NewTransaction(uint64(nonce), chain_common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		header := &types.Header{Number: big.NewInt(number), GasLimit: 8000000, Coinbase: chain_common.Address{0xaa}}
+
+		receipt, _, err := applyTransaction(config, chain, nil, new(GasPool).AddGas(header.GasLimit), statedb, statedb, header, tx, nil, new(uint64), vm.Config{})
+		if err != nil {
+			t.Fatalf("区块 #%d: 执行失败: %v", number, err)
+		}
+		// 分叉之前收据只记录状态码，从分叉区块开始携带交易后的中间状态根
+		if !config.IsReceiptRoot(header.Number) {
+			if len(receipt.PostState) != 0 || receipt.Status != types.ReceiptStatusSuccessful {
+				t.Errorf("区块 #%d: 收据不应携带状态根: 状态根 %x, 状态码 %d", number, receipt.PostState, receipt.Status)
+			}
+			continue
+		}
+		if root := statedb.IntermediateRoot(true); !bytes.Equal(receipt.PostState, root.Bytes()) {
+			t.Errorf("区块 #%d: 收据的状态根不匹配: 得到 %x, 需要 %x", number, receipt.PostState, root)
+		}
+	}
+}
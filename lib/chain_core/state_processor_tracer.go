@@ -0,0 +1,353 @@
+package chain_core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/i18"
+	"github.com/aidoc/go-aidoc/lib/state"
+	"github.com/aidoc/go-aidoc/service/produce/consensus"
+)
+
+// StorageChange 记录一个存储槽在一笔交易中的取值变化。
+type StorageChange struct {
+	Before chain_common.Hash `json:"before"`
+	After  chain_common.Hash `json:"after"`
+}
+
+// AccountChange 记录一个账户在一笔交易或区块奖励步骤中的变化。
+type AccountChange struct {
+	Address       chain_common.Address                 `json:"address"`
+	BalanceBefore *big.Int                             `json:"balanceBefore"`
+	BalanceAfter  *big.Int                             `json:"balanceAfter"`
+	NonceBefore   uint64                               `json:"nonceBefore"`
+	NonceAfter    uint64                               `json:"nonceAfter"`
+	Storage       map[chain_common.Hash]*StorageChange `json:"storage,omitempty"`
+}
+
+// TxTrace 是 StateProcessor 执行一笔交易后报告给跟踪器的结果。
+type TxTrace struct {
+	BlockNumber uint64               `json:"blockNumber"`
+	BlockHash   chain_common.Hash    `json:"blockHash"`
+	Index       int                  `json:"index"`
+	TxHash      chain_common.Hash    `json:"txHash"`
+	From        chain_common.Address `json:"from"`
+	GasUsed     uint64               `json:"gasUsed"`
+	Failed      bool                 `json:"failed"`
+	Accounts    []*AccountChange     `json:"accounts"`
+	Logs        []*types.Log         `json:"logs"`
+}
+
+// FinalizeTrace 是共识引擎 Finalize 步骤（区块奖励）之后报告给跟踪器的结果。
+type FinalizeTrace struct {
+	BlockNumber uint64            `json:"blockNumber"`
+	BlockHash   chain_common.Hash `json:"blockHash"`
+	Accounts    []*AccountChange  `json:"accounts"`
+}
+
+// BlockTracer 是 StateProcessor.Process 在每笔交易执行后以及区块最终确定后调用的跟踪接口。
+// 与 vm.Config 中的 EVM 跟踪器不同，它只报告交易对状态的净影响。
+type BlockTracer interface {
+	// CaptureTransaction 在一笔交易执行并最终确定后调用。
+	CaptureTransaction(trace *TxTrace)
+
+	// CaptureFinalize 在共识引擎的 Finalize 步骤之后调用。
+	CaptureFinalize(trace *FinalizeTrace)
+}
+
+// JSONBlockTracer 将跟踪结果以每行一个 JSON 对象的形式写入 io.Writer，可以跨多个区块收集。
+// 交易的 kind 字段为 "tx"，奖励步骤为 "finalize"。
+type JSONBlockTracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONBlockTracer 创建一个写入 w 的 JSON 跟踪器。
+func NewJSONBlockTracer(w io.Writer) *JSONBlockTracer {
+	return &JSONBlockTracer{enc: json.NewEncoder(w)}
+}
+
+// CaptureTransaction 实现 BlockTracer。
+func (t *JSONBlockTracer) CaptureTransaction(trace *TxTrace) {
+	t.write(struct {
+		Kind string `json:"kind"`
+		*TxTrace
+	}{"tx", trace})
+}
+
+// CaptureFinalize 实现 BlockTracer。
+func (t *JSONBlockTracer) CaptureFinalize(trace *FinalizeTrace) {
+	t.write(struct {
+		Kind string `json:"kind"`
+		*FinalizeTrace
+	}{"finalize", trace})
+}
+
+// Err 返回第一次写入失败的错误。
+func (t *JSONBlockTracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.err
+}
+
+func (t *JSONBlockTracer) write(v interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err == nil {
+		t.err = t.enc.Encode(v)
+	}
+}
+
+// BlockTrace 汇总一个区块的全部跟踪结果。
+type BlockTrace struct {
+	Number       uint64            `json:"number"`
+	Hash         chain_common.Hash `json:"hash"`
+	Transactions []*TxTrace        `json:"transactions"`
+	Finalize     *FinalizeTrace    `json:"finalize,omitempty"`
+}
+
+// BalanceChange 是账户余额账本中的一条记录。 TxHash 为 nil 表示区块的奖励步骤。
+type BalanceChange struct {
+	BlockNumber uint64             `json:"blockNumber"`
+	TxHash      *chain_common.Hash `json:"txHash,omitempty"`
+	Before      *big.Int           `json:"before"`
+	After       *big.Int           `json:"after"`
+}
+
+// BlockRangeCollector 是按区块收集跟踪结果的 BlockTracer，用于一次跟踪一个区块范围，
+// 然后作为一个 JSON 文档输出区块结果以及按账户整理的余额变化账本。
+type BlockRangeCollector struct {
+	mu     sync.Mutex
+	blocks []*BlockTrace
+}
+
+// NewBlockRangeCollector 创建一个空的区块范围收集器。
+func NewBlockRangeCollector() *BlockRangeCollector {
+	return new(BlockRangeCollector)
+}
+
+// CaptureTransaction 实现 BlockTracer。
+func (c *BlockRangeCollector) CaptureTransaction(trace *TxTrace) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	block := c.block(trace.BlockNumber, trace.BlockHash)
+	block.Transactions = append(block.Transactions, trace)
+}
+
+// CaptureFinalize 实现 BlockTracer。
+func (c *BlockRangeCollector) CaptureFinalize(trace *FinalizeTrace) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.block(trace.BlockNumber, trace.BlockHash).Finalize = trace
+}
+
+// block 返回正在收集的区块，区块变化时开始一个新的区块。
+func (c *BlockRangeCollector) block(number uint64, hash chain_common.Hash) *BlockTrace {
+	if n := len(c.blocks); n > 0 && c.blocks[n-1].Hash == hash {
+		return c.blocks[n-1]
+	}
+	block := &BlockTrace{Number: number, Hash: hash, Transactions: []*TxTrace{}}
+	c.blocks = append(c.blocks, block)
+	return block
+}
+
+// Blocks 按执行顺序返回已收集的区块跟踪结果。
+func (c *BlockRangeCollector) Blocks() []*BlockTrace {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]*BlockTrace(nil), c.blocks...)
+}
+
+// Ledger 返回每个账户按执行顺序排列的余额变化，余额未变化的记录被省略。
+func (c *BlockRangeCollector) Ledger() map[chain_common.Address][]*BalanceChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ledger := make(map[chain_common.Address][]*BalanceChange)
+	record := func(number uint64, txHash *chain_common.Hash, changes []*AccountChange) {
+		for _, change := range changes {
+			if change.BalanceAfter.Cmp(change.BalanceBefore) == 0 {
+				continue
+			}
+			ledger[change.Address] = append(ledger[change.Address], &BalanceChange{
+				BlockNumber: number,
+				TxHash:      txHash,
+				Before:      change.BalanceBefore,
+				After:       change.BalanceAfter,
+			})
+		}
+	}
+	for _, block := range c.blocks {
+		for _, tx := range block.Transactions {
+			hash := tx.TxHash
+			record(block.Number, &hash, tx.Accounts)
+		}
+		if block.Finalize != nil {
+			record(block.Number, nil, block.Finalize.Accounts)
+		}
+	}
+	return ledger
+}
+
+// WriteJSON 把收集的区块和余额账本作为一个 JSON 对象写入 w。
+func (c *BlockRangeCollector) WriteJSON(w io.Writer) error {
+	ledger := c.Ledger()
+	return json.NewEncoder(w).Encode(struct {
+		Blocks []*BlockTrace                             `json:"blocks"`
+		Ledger map[chain_common.Address][]*BalanceChange `json:"ledger"`
+	}{c.Blocks(), ledger})
+}
+
+// TraceRange 在各自父区块的状态上重新执行 [from, to] 范围内的规范区块，并把结果报告给 tracer。
+// 重新执行不会提交状态，也不会向数据库写入任何内容。
+func (p *StateProcessor) TraceRange(from, to uint64, tracer BlockTracer, cfg vm.Config) error {
+	traced := &StateProcessor{config: p.config, bc: p.bc, engine: p.engine, tracer: tracer}
+
+	for number := from; number <= to; number++ {
+		block := p.bc.GetBlockByNumber(number)
+		if block == nil {
+			return fmt.Errorf(i18.I18_print.Sprintf("缺少规范区块 #%d", number))
+		}
+		parent := p.bc.GetHeaderByHash(block.ParentHash())
+		if parent == nil {
+			return consensus.ErrUnknownAncestor
+		}
+		statedb, err := p.bc.StateAt(parent.Root)
+		if err != nil {
+			return err
+		}
+		if _, _, _, err := traced.Process(block, statedb, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// capture 在账户或存储槽第一次被修改前记录其原值。
+func (r *accessRecorder) capture(kind accessKind, addr chain_common.Address, slot chain_common.Hash) {
+	change := r.changes[addr]
+	if change == nil {
+		change = &AccountChange{
+			Address:       addr,
+			BalanceBefore: new(big.Int).Set(r.StateDB.GetBalance(addr)),
+			NonceBefore:   r.StateDB.GetNonce(addr),
+		}
+		r.changes[addr] = change
+	}
+	if kind == storageAccess {
+		if change.Storage == nil {
+			change.Storage = make(map[chain_common.Hash]*StorageChange)
+		}
+		if _, ok := change.Storage[slot]; !ok {
+			change.Storage[slot] = &StorageChange{Before: r.StateDB.GetState(addr, slot)}
+		}
+	}
+}
+
+// accountChanges 用当前状态补全记录的修改，去掉实际没有变化的条目，并按地址排序返回。
+func (r *accessRecorder) accountChanges() []*AccountChange {
+	changes := make([]*AccountChange, 0, len(r.changes))
+	for _, change := range r.changes {
+		if completeAccountChange(r.StateDB, change) {
+			changes = append(changes, change)
+		}
+	}
+	sortAccountChanges(changes)
+	return changes
+}
+
+// completeAccountChange 从 statedb 读取账户修改后的取值，返回账户是否确实发生了变化。
+func completeAccountChange(statedb *state.StateDB, change *AccountChange) bool {
+	change.BalanceAfter = new(big.Int).Set(statedb.GetBalance(change.Address))
+	change.NonceAfter = statedb.GetNonce(change.Address)
+
+	for slot, storage := range change.Storage {
+		if storage.After = statedb.GetState(change.Address, slot); storage.After == storage.Before {
+			delete(change.Storage, slot)
+		}
+	}
+	return len(change.Storage) > 0 || change.NonceAfter != change.NonceBefore || change.BalanceAfter.Cmp(change.BalanceBefore) != 0
+}
+
+func sortAccountChanges(changes []*AccountChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Address[:], changes[j].Address[:]) < 0
+	})
+}
+
+// applyTracedTransaction 执行区块中的第 index 笔交易，并将其对状态的影响报告给跟踪器。
+func (p *StateProcessor) applyTracedTransaction(block *types.Block, chain ChainContext, index int, gp *GasPool, statedb *state.StateDB, baseFee *big.Int, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
+	tx := block.Transactions()[index]
+
+	recorder := newAccessRecorder(statedb)
+	recorder.changes = make(map[chain_common.Address]*AccountChange)
+
+	receipt, gas, err := applyTransaction(p.config, chain, nil, gp, statedb, recorder, block.Header(), tx, baseFee, usedGas, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// 发送者已经在执行时恢复并缓存
+	from, _ := types.Sender(types.MakeTypedSigner(p.config, block.Number()), tx)
+
+	p.tracer.CaptureTransaction(&TxTrace{
+		BlockNumber: block.NumberU64(),
+		BlockHash:   block.Hash(),
+		Index:       index,
+		TxHash:      tx.Hash(),
+		From:        from,
+		GasUsed:     gas,
+		Failed:      receipt.Status == types.ReceiptStatusFailed,
+		Accounts:    recorder.accountChanges(),
+		Logs:        receipt.Logs,
+	})
+	return receipt, nil
+}
+
+// finalizeTraced 执行共识引擎的 Finalize 步骤，然后将奖励接收账户（coinbase、国库以及叔块的 coinbase）
+// 的变化报告给跟踪器。
+func (p *StateProcessor) finalizeTraced(block *types.Block, statedb *state.StateDB, receipts types.Receipts) {
+	header := block.Header()
+
+	recipients := rewardRecipients(p.config, header)
+	for _, uncle := range block.Uncles() {
+		recipients = append(recipients, uncle.Coinbase)
+	}
+	seen := make(map[chain_common.Address]bool)
+
+	changes := make([]*AccountChange, 0, len(recipients))
+	for _, addr := range recipients {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		changes = append(changes, &AccountChange{
+			Address:       addr,
+			BalanceBefore: new(big.Int).Set(statedb.GetBalance(addr)),
+			NonceBefore:   statedb.GetNonce(addr),
+		})
+	}
+	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), receipts)
+
+	trace := &FinalizeTrace{BlockNumber: block.NumberU64(), BlockHash: block.Hash()}
+	for _, change := range changes {
+		if completeAccountChange(statedb, change) {
+			trace.Accounts = append(trace.Accounts, change)
+		}
+	}
+	sortAccountChanges(trace.Accounts)
+	p.tracer.CaptureFinalize(trace)
+}
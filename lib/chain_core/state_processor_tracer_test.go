@@ -0,0 +1,175 @@
+package chain_core
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/state"
+	"github.com/aidoc/go-aidoc/service/produce/consensus"
+)
+
+// testRewardEngine 在 Finalize 中给 coinbase 和 uncles 中每个叔块的 coinbase 发放 reward。
+type testRewardEngine struct {
+	testEngine
+	reward *big.Int
+	uncles []*types.Header
+}
+
+func (e *testRewardEngine) Finalize(chain consensus.ChainReader, header *types.Header, statedb *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*types.Block, error) {
+	statedb.AddBalance(header.Coinbase, e.reward)
+	for _, uncle := range e.uncles {
+		statedb.AddBalance(uncle.Coinbase, e.reward)
+	}
+	header.Root = statedb.IntermediateRoot(true)
+	return types.NewBlock(header, txs, e.uncles, receipts), nil
+}
+
+func TestBlockTracer(t *testing.T) {
+	var (
+		config    = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0)}
+		signer    = types.MakeSigner(config, big.NewInt(1))
+		counter   = chain_common.Address{0xcc}
+		recipient = chain_common.Address{0x01}
+		coinbase  = chain_common.Address{0xaa}
+		uncle     = &types.Header{Number: big.NewInt(0), Coinbase: chain_common.Address{0xbb}}
+		key, _    = crypto.GenerateKey()
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	sign := func(nonce uint64, to chain_common.Address, value int64, gas uint64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(value), gas, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		return tx
+	}
+	txs := types.Transactions{
+		sign(0, recipient, 1000, 21000),
+		sign(1, counter, 0, 100000),
+	}
+	block := types.NewBlockWithHeader(&types.Header{
+		Number:   big.NewInt(1),
+		GasLimit: 8000000,
+		Coinbase: coinbase,
+	}).WithBody(txs, []*types.Header{uncle})
+
+	var (
+		collector = NewBlockRangeCollector()
+		engine    = &testRewardEngine{reward: big.NewInt(5000), uncles: block.Uncles()}
+		p         = &StateProcessor{config: config, engine: engine, tracer: collector}
+		statedb   = newParallelTestState(t, counter, sender)
+		balance   = new(big.Int).Set(statedb.GetBalance(sender))
+	)
+	receipts, _, err := p.processSerial(block, &testChainContext{engine: engine}, statedb, new(GasPool).AddGas(block.GasLimit()), nil, new(uint64), vm.Config{})
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	p.finalizeTraced(block, statedb, receipts)
+
+	blocks := collector.Blocks()
+	if len(blocks) != 1 || len(blocks[0].Transactions) != 2 || blocks[0].Finalize == nil {
+		t.Fatalf("收集的区块不匹配: %+v", blocks)
+	}
+	transfer, call := blocks[0].Transactions[0], blocks[0].Transactions[1]
+	if transfer.From != sender || transfer.GasUsed != 21000 || transfer.Failed {
+		t.Errorf("转账跟踪不匹配: %+v", transfer)
+	}
+	accounts := make(map[chain_common.Address]*AccountChange)
+	for _, change := range transfer.Accounts {
+		accounts[change.Address] = change
+	}
+	if change := accounts[sender]; change == nil || change.BalanceBefore.Cmp(balance) != 0 || change.NonceBefore != 0 || change.NonceAfter != 1 {
+		t.Errorf("发送者变化不匹配: %+v", change)
+	}
+	if change := accounts[recipient]; change == nil || change.BalanceBefore.Sign() != 0 || change.BalanceAfter.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("接收者变化不匹配: %+v", change)
+	}
+	var storage *StorageChange
+	for _, change := range call.Accounts {
+		if change.Address == counter {
+			storage = change.Storage[chain_common.Hash{}]
+		}
+	}
+	if storage == nil || storage.Before != (chain_common.Hash{}) || storage.After != chain_common.BigToHash(big.NewInt(1)) {
+		t.Errorf("存储变化不匹配: %+v", storage)
+	}
+	if len(call.Logs) != 1 {
+		t.Errorf("日志数量不匹配: 得到 %d, 需要 1", len(call.Logs))
+	}
+	// 奖励步骤必须同时报告 coinbase 和叔块 coinbase 的变化
+	rewarded := make(map[chain_common.Address]*big.Int)
+	for _, change := range blocks[0].Finalize.Accounts {
+		rewarded[change.Address] = new(big.Int).Sub(change.BalanceAfter, change.BalanceBefore)
+	}
+	for _, addr := range []chain_common.Address{coinbase, uncle.Coinbase} {
+		if reward := rewarded[addr]; reward == nil || reward.Cmp(engine.reward) != 0 {
+			t.Errorf("%x 的奖励不匹配: 得到 %v, 需要 %v", addr, reward, engine.reward)
+		}
+	}
+	// 账本按执行顺序列出余额变化，奖励步骤没有交易哈希
+	ledger := collector.Ledger()
+	if entries := ledger[sender]; len(entries) != 2 || *entries[0].TxHash != txs[0].Hash() || *entries[1].TxHash != txs[1].Hash() {
+		t.Errorf("发送者账本不匹配: %+v", entries)
+	}
+	if entries := ledger[uncle.Coinbase]; len(entries) != 1 || entries[0].TxHash != nil || entries[0].BlockNumber != 1 {
+		t.Errorf("叔块 coinbase 账本不匹配: %+v", entries)
+	}
+	if entries := ledger[counter]; len(entries) != 0 {
+		t.Errorf("余额未变化的账户不应出现在账本中: %+v", entries)
+	}
+}
+
+func TestBlockRangeCollectorJSON(t *testing.T) {
+	var (
+		collector = NewBlockRangeCollector()
+		addr      = chain_common.Address{0x01}
+	)
+	for number := uint64(1); number <= 3; number++ {
+		hash := chain_common.BigToHash(new(big.Int).SetUint64(number))
+		collector.CaptureTransaction(&TxTrace{
+			BlockNumber: number,
+			BlockHash:   hash,
+			TxHash:      chain_common.Hash{byte(number)},
+			Accounts: []*AccountChange{{
+				Address:       addr,
+				BalanceBefore: big.NewInt(int64(number)),
+				BalanceAfter:  big.NewInt(int64(number + 1)),
+			}},
+		})
+		collector.CaptureFinalize(&FinalizeTrace{BlockNumber: number, BlockHash: hash})
+	}
+	var buf bytes.Buffer
+	if err := collector.WriteJSON(&buf); err != nil {
+		t.Fatalf("无法写入 JSON: %v", err)
+	}
+	var out struct {
+		Blocks []*BlockTrace                             `json:"blocks"`
+		Ledger map[chain_common.Address][]*BalanceChange `json:"ledger"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("无法解码 JSON: %v", err)
+	}
+	if len(out.Blocks) != 3 {
+		t.Fatalf("区块数量不匹配: 得到 %d, 需要 3", len(out.Blocks))
+	}
+	for i, block := range out.Blocks {
+		if block.Number != uint64(i+1) || len(block.Transactions) != 1 || block.Finalize == nil {
+			t.Errorf("区块 %d 不匹配: %+v", i, block)
+		}
+	}
+	entries := out.Ledger[addr]
+	if len(entries) != 3 {
+		t.Fatalf("账本条目数量不匹配: 得到 %d, 需要 3", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.BlockNumber != uint64(i+1) || entry.After.Int64() != int64(i+2) {
+			t.Errorf("账本条目 %d 不匹配: %+v", i, entry)
+		}
+	}
+}
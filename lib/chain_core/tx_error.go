@@ -0,0 +1,128 @@
+package chain_core
+
+import (
+	"errors"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/i18"
+)
+
+// TxErrorReason 是交易无法执行的原因代码，可供区块生产者决定丢弃还是稍后重试交易。
+type TxErrorReason uint8
+
+const (
+	TxErrUnknown           TxErrorReason = iota // 无法归类的错误
+	TxErrNonceTooLow                            // nonce 低于账户当前 nonce，交易应丢弃
+	TxErrNonceTooHigh                           // nonce 高于账户当前 nonce，交易可以稍后重试
+	TxErrGasLimitReached                        // 区块 gas 池耗尽，交易可以放入下一个区块
+	TxErrInsufficientFunds                      // 余额（或代付账户的余额）不足以支付 gas * price
+	TxErrInvalidSig                             // 签名无效，无法恢复发送者或代付账户
+	TxErrInvalidChainId                         // 签名中的链 ID 与当前链不符
+	TxErrTypeNotSupported                       // 当前高度不接受该类型的交易
+	TxErrFeeCapTooLow                           // 费用上限低于区块的基础费用，交易可以等基础费用下降后重试
+	TxErrIntrinsicGas                           // gas 限制低于交易的内在 gas（包括访问列表的gas），交易应丢弃
+	TxErrTipAboveFeeCap                         // 小费上限高于费用上限，交易应丢弃
+	TxErrMissingBaseFee                         // 无法确定区块的基础费用，区块本身无效
+)
+
+var txErrorReasonNames = [...]string{
+	TxErrUnknown:           "unknown",
+	TxErrNonceTooLow:       "nonce-too-low",
+	TxErrNonceTooHigh:      "nonce-too-high",
+	TxErrGasLimitReached:   "gas-limit-reached",
+	TxErrInsufficientFunds: "insufficient-funds",
+	TxErrInvalidSig:        "invalid-signature",
+	TxErrInvalidChainId:    "invalid-chain-id",
+	TxErrTypeNotSupported:  "tx-type-not-supported",
+	TxErrFeeCapTooLow:      "fee-cap-too-low",
+	TxErrIntrinsicGas:      "intrinsic-gas-too-low",
+	TxErrTipAboveFeeCap:    "tip-above-fee-cap",
+	TxErrMissingBaseFee:    "missing-base-fee",
+}
+
+// String 返回原因代码的机器可读名称。
+func (r TxErrorReason) String() string {
+	if int(r) < len(txErrorReasonNames) {
+		return txErrorReasonNames[r]
+	}
+	return txErrorReasonNames[TxErrUnknown]
+}
+
+// TxError 描述了一笔交易无法执行的原因。 调用方可以通过 errors.Is 与底层错误（例如 ErrNonceTooLow）
+// 比较，也可以通过 errors.As 取出 TxError 并按 Reason 分类处理。
+type TxError struct {
+	TxHash chain_common.Hash // 失败交易的哈希
+	Index  int               // 交易在区块中的位置，不在区块中执行时为 -1
+	Reason TxErrorReason     // 失败原因代码
+	Err    error             // 底层错误
+}
+
+func (e *TxError) Error() string {
+	if e.Index < 0 {
+		return i18.I18_print.Sprintf("交易 [%x…] 执行失败 (%s): %v", e.TxHash.Bytes()[:4], e.Reason, e.Err)
+	}
+	return i18.I18_print.Sprintf("交易 #%d [%x…] 执行失败 (%s): %v", e.Index, e.TxHash.Bytes()[:4], e.Reason, e.Err)
+}
+
+// Unwrap 返回底层错误，使调用方可以使用 errors.Is 判断错误类型。
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// Is 使 errors.Is(err, &TxError{Reason: r}) 可以按原因代码匹配任意交易的错误。
+func (e *TxError) Is(target error) bool {
+	t, ok := target.(*TxError)
+	return ok && t.Reason == e.Reason
+}
+
+// newTxError 将交易执行失败的错误包装为 TxError 并归类原因。 已经包含 TxError 的错误原样返回。
+func newTxError(tx *types.Transaction, err error) error {
+	if err == nil {
+		return nil
+	}
+	var txErr *TxError
+	if errors.As(err, &txErr) {
+		return err
+	}
+	return &TxError{TxHash: tx.Hash(), Index: -1, Reason: classifyTxError(err), Err: err}
+}
+
+// withTxIndex 为 TxError 填写交易在区块中的位置。
+func withTxIndex(err error, index int) error {
+	var txErr *TxError
+	if errors.As(err, &txErr) {
+		txErr.Index = index
+	}
+	return err
+}
+
+// classifyTxError 返回底层错误对应的原因代码。 applyTransaction 可能返回的每个错误都有对应的原因代码。
+func classifyTxError(err error) TxErrorReason {
+	switch {
+	case errors.Is(err, ErrNonceTooLow):
+		return TxErrNonceTooLow
+	case errors.Is(err, ErrNonceTooHigh):
+		return TxErrNonceTooHigh
+	case errors.Is(err, ErrGasLimitReached):
+		return TxErrGasLimitReached
+	case errors.Is(err, errInsufficientBalanceForGas), errors.Is(err, ErrInsufficientFeePayerFunds), errors.Is(err, vm.ErrInsufficientBalance):
+		return TxErrInsufficientFunds
+	case errors.Is(err, types.ErrInvalidSig), errors.Is(err, types.ErrInvalidFeePayerSig):
+		return TxErrInvalidSig
+	case errors.Is(err, types.ErrInvalidChainId):
+		return TxErrInvalidChainId
+	case errors.Is(err, types.ErrTxTypeNotSupported):
+		return TxErrTypeNotSupported
+	case errors.Is(err, ErrFeeCapTooLow):
+		return TxErrFeeCapTooLow
+	case errors.Is(err, ErrIntrinsicGas), errors.Is(err, vm.ErrOutOfGas):
+		return TxErrIntrinsicGas
+	case errors.Is(err, ErrTipAboveFeeCap):
+		return TxErrTipAboveFeeCap
+	case errors.Is(err, errMissingBaseFee):
+		return TxErrMissingBaseFee
+	}
+	return TxErrUnknown
+}
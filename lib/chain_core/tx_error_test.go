@@ -0,0 +1,81 @@
+package chain_core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+)
+
+func TestTxErrorClassification(t *testing.T) {
+	tx := types.NewTransaction(0, chain_common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil)
+
+	tests := []struct {
+		err    error
+		reason TxErrorReason
+	}{
+		{ErrNonceTooLow, TxErrNonceTooLow},
+		{ErrNonceTooHigh, TxErrNonceTooHigh},
+		{ErrGasLimitReached, TxErrGasLimitReached},
+		{errInsufficientBalanceForGas, TxErrInsufficientFunds},
+		{ErrInsufficientFeePayerFunds, TxErrInsufficientFunds},
+		{types.ErrInvalidSig, TxErrInvalidSig},
+		{types.ErrInvalidFeePayerSig, TxErrInvalidSig},
+		{types.ErrInvalidChainId, TxErrInvalidChainId},
+		{types.ErrTxTypeNotSupported, TxErrTypeNotSupported},
+		{ErrFeeCapTooLow, TxErrFeeCapTooLow},
+		{vm.ErrInsufficientBalance, TxErrInsufficientFunds},
+		{ErrIntrinsicGas, TxErrIntrinsicGas},
+		{vm.ErrOutOfGas, TxErrIntrinsicGas},
+		{ErrTipAboveFeeCap, TxErrTipAboveFeeCap},
+		{errMissingBaseFee, TxErrMissingBaseFee},
+		{errors.New("其他错误"), TxErrUnknown},
+	}
+	for _, test := range tests {
+		// 底层错误被再包装一层时也必须能够归类
+		for _, cause := range []error{test.err, fmt.Errorf("包装: %w", test.err)} {
+			err := withTxIndex(newTxError(tx, cause), 3)
+
+			var txErr *TxError
+			if !errors.As(err, &txErr) {
+				t.Errorf("%v: errors.As 无法取出 *TxError", cause)
+				continue
+			}
+			if txErr.Reason != test.reason || txErr.Index != 3 || txErr.TxHash != tx.Hash() {
+				t.Errorf("%v: 得到 (%s, %d, %x), 需要 (%s, 3, %x)", cause, txErr.Reason, txErr.Index, txErr.TxHash, test.reason, tx.Hash())
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("%v: errors.Is 无法匹配底层错误", cause)
+			}
+			if !errors.Is(err, &TxError{Reason: test.reason}) {
+				t.Errorf("%v: errors.Is 无法按原因代码 %s 匹配", cause, test.reason)
+			}
+			if test.reason != TxErrUnknown && errors.Is(err, &TxError{Reason: TxErrUnknown}) {
+				t.Errorf("%v: 不应按原因代码 %s 匹配", cause, TxErrUnknown)
+			}
+			// 包装在其他错误中的 TxError 同样可以取出
+			if wrapped := fmt.Errorf("区块处理失败: %w", err); !errors.As(wrapped, &txErr) || !errors.Is(wrapped, test.err) {
+				t.Errorf("%v: 无法通过外层错误访问 *TxError", cause)
+			}
+		}
+	}
+	// 已经是 TxError 的错误不会被再次包装
+	err := newTxError(tx, ErrNonceTooLow)
+	if newTxError(tx, err) != err {
+		t.Errorf("TxError 被重复包装")
+	}
+	wrapped := fmt.Errorf("包装: %w", err)
+	if newTxError(tx, wrapped) != wrapped {
+		t.Errorf("包装后的 TxError 被重复包装")
+	}
+	if withTxIndex(wrapped, 5); err.(*TxError).Index != 5 {
+		t.Errorf("无法为包装后的 TxError 设置位置")
+	}
+	if newTxError(tx, nil) != nil {
+		t.Errorf("nil 错误不应被包装")
+	}
+}
@@ -0,0 +1,36 @@
+package chain_core
+
+import (
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/state"
+)
+
+// validateTxFunds 检查发送者和代付账户的余额是否足以支付交易，代付gas的交易还会校验代付账户的签名。
+// from 是已经校验过签名的发送者。 交易池在接受交易时调用它。
+//
+// 发送者支付 Cost（代付gas的交易只有转账金额），代付账户支付 FeePayerCost；两者是同一账户时按总额检查。
+// sponsored 返回代付账户已经为池中其他交易承担的 gas 费用，代付账户的余额必须同时覆盖这部分费用。
+func validateTxFunds(signer types.Signer, tx *types.Transaction, from chain_common.Address, statedb *state.StateDB, sponsored func(payer chain_common.Address) *big.Int) error {
+	cost := tx.Cost()
+	if tx.Type() == types.FeePayerTxType {
+		payer, err := types.FeePayer(signer, tx)
+		if err != nil {
+			return err
+		}
+		total := sponsored(payer)
+		total.Add(total, tx.FeePayerCost())
+
+		if payer == from {
+			cost.Add(cost, total)
+		} else if statedb.GetBalance(payer).Cmp(total) < 0 {
+			return ErrInsufficientFeePayerFunds
+		}
+	}
+	if statedb.GetBalance(from).Cmp(cost) < 0 {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package chain_core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+// feePayerTransaction 创建一笔由 key 签名、由 payer 代付gas的交易。 payer 为 nil 时交易缺少代付签名。
+func feePayerTransaction(t *testing.T, chainID *big.Int, nonce uint64, value int64, gaslimit uint64, gasprice int64, key, payer *ecdsa.PrivateKey, payerAddr chain_common.Address) *types.Transaction {
+	signer := types.NewTypedTxSigner(chainID)
+	tx := types.NewFeePayerTransaction(chainID, nonce, &chain_common.Address{0x01}, big.NewInt(value), gaslimit, big.NewInt(gasprice), nil, payerAddr)
+
+	tx, err := types.SignTx(tx, signer, key)
+	if err != nil {
+		t.Fatalf("无法签名交易: %v", err)
+	}
+	if payer == nil {
+		return tx
+	}
+	sig, err := crypto.Sign(signer.FeePayerHash(tx).Bytes(), payer)
+	if err != nil {
+		t.Fatalf("无法签名代付交易: %v", err)
+	}
+	if tx, err = tx.WithFeePayerSignature(signer, sig); err != nil {
+		t.Fatalf("无法设置代付签名: %v", err)
+	}
+	return tx
+}
+
+func TestValidateTxFunds(t *testing.T) {
+	var (
+		chainID   = big.NewInt(1)
+		signer    = types.NewTypedTxSigner(chainID)
+		key, _    = crypto.GenerateKey()
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+		payer, _  = crypto.GenerateKey()
+		payerAddr = crypto.PubkeyToAddress(payer.PublicKey)
+		statedb   = newParallelTestState(t, chain_common.Address{0xcc})
+	)
+	statedb.AddBalance(payerAddr, big.NewInt(250000))
+
+	sponsored := func(amount int64) func(chain_common.Address) *big.Int {
+		return func(chain_common.Address) *big.Int { return big.NewInt(amount) }
+	}
+	tests := []struct {
+		tx        *types.Transaction
+		from      chain_common.Address
+		sponsored int64 // 代付账户已经为其他交易承担的费用
+		err       error
+	}{
+		// 发送者没有余额，代付账户支付全部 gas 费用
+		{feePayerTransaction(t, chainID, 0, 0, 100000, 1, key, payer, payerAddr), sender, 0, nil},
+		// 代付账户已经承担的费用计入检查
+		{feePayerTransaction(t, chainID, 0, 0, 100000, 1, key, payer, payerAddr), sender, 150001, ErrInsufficientFeePayerFunds},
+		// 代付账户只承担 gas 费用，转账金额仍由发送者支付
+		{feePayerTransaction(t, chainID, 0, 1, 21000, 1, key, payer, payerAddr), sender, 0, ErrInsufficientFunds},
+		// 缺少代付签名的交易被拒绝
+		{feePayerTransaction(t, chainID, 0, 0, 21000, 1, key, nil, payerAddr), sender, 0, types.ErrInvalidFeePayerSig},
+		// 发送者自己代付时按总额检查
+		{feePayerTransaction(t, chainID, 0, 0, 100000, 2, payer, payer, payerAddr), payerAddr, 50001, ErrInsufficientFunds},
+		{feePayerTransaction(t, chainID, 0, 0, 100000, 2, payer, payer, payerAddr), payerAddr, 50000, nil},
+	}
+	for i, test := range tests {
+		if err := validateTxFunds(signer, test.tx, test.from, statedb, sponsored(test.sponsored)); err != test.err {
+			t.Errorf("测试 %d: 错误不匹配: 得到 %v, 需要 %v", i, err, test.err)
+		}
+	}
+}
+
+func TestApplyFeePayerTransaction(t *testing.T) {
+	var (
+		config    = &configs.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0), FeePayerBlock: big.NewInt(0)}
+		chainID   = config.ChainID
+		coinbase  = chain_common.Address{0xaa}
+		key, _    = crypto.GenerateKey()
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+		payer, _  = crypto.GenerateKey()
+		payerAddr = crypto.PubkeyToAddress(payer.PublicKey)
+		header    = &types.Header{Number: big.NewInt(1), GasLimit: 8000000, Coinbase: coinbase}
+		chain     = &testChainContext{engine: &testEngine{}}
+	)
+	statedb := newParallelTestState(t, chain_common.Address{0xcc})
+	statedb.AddBalance(sender, big.NewInt(10))
+	statedb.AddBalance(payerAddr, big.NewInt(1000000))
+
+	// 代付账户预付 100000 * 2，执行只使用 21000，未使用的部分退还给代付账户
+	tx := feePayerTransaction(t, chainID, 0, 5, 100000, 2, key, payer, payerAddr)
+	receipt, gas, err := applyTransaction(config, chain, nil, new(GasPool).AddGas(header.GasLimit), statedb, statedb, header, tx, nil, new(uint64), vm.Config{})
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if gas != 21000 || receipt.GasUsed != 21000 {
+		t.Fatalf("使用的gas不匹配: 得到 %d, 需要 21000", gas)
+	}
+	if have := statedb.GetBalance(sender); have.Int64() != 5 {
+		t.Errorf("发送者余额不匹配: 得到 %v, 需要 5", have)
+	}
+	if have := statedb.GetBalance(payerAddr); have.Int64() != 1000000-21000*2 {
+		t.Errorf("代付账户余额不匹配: 得到 %v, 需要 %d", have, 1000000-21000*2)
+	}
+	if have := statedb.GetBalance(coinbase); have.Int64() != 21000*2 {
+		t.Errorf("coinbase 余额不匹配: 得到 %v, 需要 %d", have, 21000*2)
+	}
+	// 代付账户的余额不足以预付全部 gas 费用
+	tx = feePayerTransaction(t, chainID, 1, 0, 1000000, 1, key, payer, payerAddr)
+	_, _, err = applyTransaction(config, chain, nil, new(GasPool).AddGas(header.GasLimit), statedb, statedb, header, tx, nil, new(uint64), vm.Config{})
+	if !errors.Is(err, ErrInsufficientFeePayerFunds) {
+		t.Errorf("代付账户余额不足: 得到 %v, 需要 %v", err, ErrInsufficientFeePayerFunds)
+	}
+}
@@ -0,0 +1,161 @@
+package chain_core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/i18"
+	"github.com/aidoc/go-aidoc/lib/logger"
+)
+
+// TxFilter 是交易池在接受任何交易之前调用的准入过滤器。
+type TxFilter interface {
+	// FilterTx 检查一笔交易，返回非 nil 的错误表示拒绝该交易，错误内容即拒绝原因。
+	// to 为 nil 表示创建合约。 实现必须可以被并发调用。
+	FilterTx(from chain_common.Address, to *chain_common.Address, value *big.Int, data []byte, gasPrice *big.Int) error
+}
+
+// TxFilterError 是 TxAccountFilter 拒绝交易时返回的错误。
+type TxFilterError struct {
+	Address chain_common.Address // 被拒绝的账户
+	Reason  string               // 拒绝原因
+}
+
+func (e *TxFilterError) Error() string {
+	return i18.I18_print.Sprintf("交易被准入过滤器拒绝: %s %x", e.Reason, e.Address)
+}
+
+// accountLists 是一组允许名单和拒绝名单。
+type accountLists struct {
+	Allow []chain_common.Address `json:"allow,omitempty"` // 非空时只允许名单中的账户
+	Deny  []chain_common.Address `json:"deny,omitempty"`  // 拒绝名单，优先于允许名单
+}
+
+// txAccountFilterFile 是 TxAccountFilter 配置文件的格式。
+type txAccountFilterFile struct {
+	Senders    accountLists `json:"senders"`
+	Recipients accountLists `json:"recipients"`
+}
+
+// accountSetLists 是加载后用于查找的名单。
+type accountSetLists struct {
+	allow map[chain_common.Address]struct{}
+	deny  map[chain_common.Address]struct{}
+}
+
+func newAccountSetLists(lists accountLists) accountSetLists {
+	set := accountSetLists{
+		allow: make(map[chain_common.Address]struct{}, len(lists.Allow)),
+		deny:  make(map[chain_common.Address]struct{}, len(lists.Deny)),
+	}
+	for _, addr := range lists.Allow {
+		set.allow[addr] = struct{}{}
+	}
+	for _, addr := range lists.Deny {
+		set.deny[addr] = struct{}{}
+	}
+	return set
+}
+
+// check 返回账户被拒绝的原因，允许时返回空字符串。
+func (s accountSetLists) check(addr chain_common.Address) string {
+	if _, ok := s.deny[addr]; ok {
+		return "denied"
+	}
+	if len(s.allow) > 0 {
+		if _, ok := s.allow[addr]; !ok {
+			return "not allowed"
+		}
+	}
+	return ""
+}
+
+// TxAccountFilter 是按发送者和接收者的允许/拒绝名单过滤交易的 TxFilter 实现。 名单从 JSON 文件加载：
+//
+//	{
+//	  "senders":    {"allow": ["0x..."], "deny": ["0x..."]},
+//	  "recipients": {"allow": ["0x..."], "deny": ["0x..."]}
+//	}
+//
+// 拒绝名单优先于允许名单；允许名单为空时不限制。 创建合约的交易没有接收者，只检查发送者。
+type TxAccountFilter struct {
+	path string
+
+	lock       sync.RWMutex
+	senders    accountSetLists
+	recipients accountSetLists
+}
+
+// NewTxAccountFilter 从 path 加载名单并创建过滤器。
+func NewTxAccountFilter(path string) (*TxAccountFilter, error) {
+	filter := &TxAccountFilter{path: path}
+	if err := filter.Reload(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Reload 重新读取名单文件。 读取或解析失败时保留原有名单并返回错误。
+func (f *TxAccountFilter) Reload() error {
+	blob, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var file txAccountFilterFile
+	if err := json.Unmarshal(blob, &file); err != nil {
+		return fmt.Errorf(i18.I18_print.Sprintf("无效的交易过滤名单 %s: %v", f.path, err))
+	}
+	senders, recipients := newAccountSetLists(file.Senders), newAccountSetLists(file.Recipients)
+
+	f.lock.Lock()
+	f.senders, f.recipients = senders, recipients
+	f.lock.Unlock()
+
+	logger.Info("已加载交易过滤名单", "path", f.path,
+		"senderAllow", len(senders.allow), "senderDeny", len(senders.deny),
+		"recipientAllow", len(recipients.allow), "recipientDeny", len(recipients.deny))
+	return nil
+}
+
+// WatchSignals 在收到 SIGHUP 时重新加载名单，直到 quit 关闭。
+func (f *TxAccountFilter) WatchSignals(quit <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-sigs:
+				if err := f.Reload(); err != nil {
+					logger.Warn("无法重新加载交易过滤名单", "path", f.path, "err", err)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// FilterTx 实现 TxFilter。
+func (f *TxAccountFilter) FilterTx(from chain_common.Address, to *chain_common.Address, value *big.Int, data []byte, gasPrice *big.Int) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if reason := f.senders.check(from); reason != "" {
+		return &TxFilterError{Address: from, Reason: "sender " + reason}
+	}
+	if to != nil {
+		if reason := f.recipients.check(*to); reason != "" {
+			return &TxFilterError{Address: *to, Reason: "recipient " + reason}
+		}
+	}
+	return nil
+}
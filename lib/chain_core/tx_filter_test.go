@@ -0,0 +1,125 @@
+package chain_core
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+)
+
+// writeFilterFile 把名单写入 path。
+func writeFilterFile(t *testing.T, path string, file txAccountFilterFile) {
+	blob, err := json.Marshal(file)
+	if err != nil {
+		t.Fatalf("无法编码名单: %v", err)
+	}
+	if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+		t.Fatalf("无法写入名单: %v", err)
+	}
+}
+
+// newFilterFile 创建一个临时名单文件并返回其路径。
+func newFilterFile(t *testing.T, file txAccountFilterFile) string {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("无法创建临时名单文件: %v", err)
+	}
+	f.Close()
+	writeFilterFile(t, f.Name(), file)
+	return f.Name()
+}
+
+// gasPriceFilter 拒绝 gas 价格高于 max 的交易。
+type gasPriceFilter struct {
+	max *big.Int
+}
+
+func (f *gasPriceFilter) FilterTx(from chain_common.Address, to *chain_common.Address, value *big.Int, data []byte, gasPrice *big.Int) error {
+	if gasPrice.Cmp(f.max) > 0 {
+		return errors.New("gas 价格过高")
+	}
+	return nil
+}
+
+func TestTxAccountFilter(t *testing.T) {
+	var (
+		denied    = chain_common.Address{0x01}
+		sender    = chain_common.Address{0x02}
+		recipient = chain_common.Address{0x03}
+		other     = chain_common.Address{0x04}
+	)
+	path := newFilterFile(t, txAccountFilterFile{
+		Senders:    accountLists{Deny: []chain_common.Address{denied}},
+		Recipients: accountLists{Allow: []chain_common.Address{recipient}},
+	})
+	defer os.Remove(path)
+
+	filter, err := NewTxAccountFilter(path)
+	if err != nil {
+		t.Fatalf("无法加载名单: %v", err)
+	}
+	tests := []struct {
+		from   chain_common.Address
+		to     *chain_common.Address
+		reason string // 空字符串表示允许
+	}{
+		{sender, &recipient, ""},
+		{sender, nil, ""}, // 创建合约只检查发送者
+		{denied, &recipient, "sender denied"},
+		{sender, &other, "recipient not allowed"},
+	}
+	check := func() {
+		for i, test := range tests {
+			err := filter.FilterTx(test.from, test.to, big.NewInt(0), nil, big.NewInt(1))
+
+			var filterErr *TxFilterError
+			switch {
+			case test.reason == "" && err != nil:
+				t.Errorf("测试 %d: 交易被拒绝: %v", i, err)
+			case test.reason != "" && (!errors.As(err, &filterErr) || filterErr.Reason != test.reason):
+				t.Errorf("测试 %d: 拒绝原因不匹配: 得到 %v, 需要 %s", i, err, test.reason)
+			}
+		}
+	}
+	check()
+
+	// 收到 SIGHUP 后重新加载名单
+	quit := make(chan struct{})
+	defer close(quit)
+	filter.WatchSignals(quit)
+
+	writeFilterFile(t, path, txAccountFilterFile{Senders: accountLists{Deny: []chain_common.Address{sender}}})
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("无法发送 SIGHUP: %v", err)
+	}
+	tests = []struct {
+		from   chain_common.Address
+		to     *chain_common.Address
+		reason string
+	}{
+		{denied, &other, ""},
+		{sender, &recipient, "sender denied"},
+	}
+	for deadline := time.Now().Add(2 * time.Second); filter.FilterTx(sender, nil, big.NewInt(0), nil, big.NewInt(1)) == nil; {
+		if time.Now().After(deadline) {
+			t.Fatalf("收到 SIGHUP 后没有重新加载名单")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	check()
+
+	// 无效的名单不会替换原有名单
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatalf("无法写入名单: %v", err)
+	}
+	if err := filter.Reload(); err == nil {
+		t.Fatalf("无效的名单被接受")
+	}
+	check()
+}
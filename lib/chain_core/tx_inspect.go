@@ -0,0 +1,158 @@
+package chain_core
+
+import (
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/hexutil"
+	"github.com/aidoc/go-aidoc/service/rpc"
+)
+
+// 队列中交易无法执行的原因。
+const (
+	TxQueuedStale               = "stale"                // nonce低于账户的下一个nonce，交易会在下一次提升时被删除
+	TxQueuedNonceGap            = "nonce-gap"            // 前面缺少nonce，交易还不能执行
+	TxQueuedInsufficientBalance = "insufficient-balance" // 余额不足以支付之前的交易和这笔交易的最大花费
+	TxQueuedAwaitingPromotion   = "awaiting-promotion"   // 交易已经可以执行，等待交易池下一次提升
+)
+
+// TxPoolEntry 描述交易池中的一笔交易。
+type TxPoolEntry struct {
+	Hash     chain_common.Hash `json:"hash"`
+	Nonce    hexutil.Uint64    `json:"nonce"`
+	Gas      hexutil.Uint64    `json:"gas"`
+	GasPrice *hexutil.Big      `json:"gasPrice"`
+	Cost     *hexutil.Big      `json:"cost"`             // 交易的最大花费（Transaction.Cost）
+	Reason   string            `json:"reason,omitempty"` // 队列中的交易无法执行的原因，可执行交易为空
+}
+
+// TxPoolContent 是交易池内容按发送者分组的快照，每个发送者的交易按nonce升序排列。
+type TxPoolContent struct {
+	Pending map[chain_common.Address][]*TxPoolEntry `json:"pending"`
+	Queued  map[chain_common.Address][]*TxPoolEntry `json:"queued"`
+}
+
+// txPoolState 是检查队列交易所需的账户状态。
+type txPoolState interface {
+	GetNonce(addr chain_common.Address) uint64
+	GetBalance(addr chain_common.Address) *big.Int
+}
+
+// inspectTxPool 根据交易池的可执行映射和队列映射生成内容快照，并用 state 判断每笔队列交易无法执行的原因。
+// 调用方必须持有交易池的锁。
+func inspectTxPool(pending, queue map[chain_common.Address]*txList, state txPoolState) *TxPoolContent {
+	content := &TxPoolContent{
+		Pending: make(map[chain_common.Address][]*TxPoolEntry, len(pending)),
+		Queued:  make(map[chain_common.Address][]*TxPoolEntry, len(queue)),
+	}
+	for addr, list := range pending {
+		for _, tx := range list.Flatten() {
+			content.Pending[addr] = append(content.Pending[addr], newTxPoolEntry(tx, ""))
+		}
+	}
+	for addr, list := range queue {
+		content.Queued[addr] = inspectQueued(addr, pending[addr], list, state)
+	}
+	return content
+}
+
+// inspectQueued 按nonce顺序检查一个发送者的队列交易。 期望的下一个nonce是可执行列表之后的nonce，
+// 如果没有可执行交易则是账户的当前nonce；低于它的交易已经过时，一旦出现缺口，之后的交易都视为被缺口阻塞。
+//
+// 余额按顺序支付可执行交易和之前的每笔队列交易的最大花费，剩余余额不足以支付的交易标记为余额不足。
+func inspectQueued(addr chain_common.Address, pending, queued *txList, state txPoolState) []*TxPoolEntry {
+	var (
+		next  = state.GetNonce(addr)
+		spent = new(big.Int)
+	)
+	if pending != nil && !pending.Empty() {
+		txs := pending.Flatten()
+		next = txs[len(txs)-1].Nonce() + 1
+		spent = pending.Spend()
+	}
+	var (
+		balance = state.GetBalance(addr)
+		entries []*TxPoolEntry
+		gapped  bool
+	)
+	for _, tx := range queued.Flatten() {
+		var reason string
+		switch {
+		case tx.Nonce() < next:
+			entries = append(entries, newTxPoolEntry(tx, TxQueuedStale))
+			continue
+		case gapped || tx.Nonce() != next:
+			gapped, reason = true, TxQueuedNonceGap
+		case spent.Add(spent, tx.Cost()).Cmp(balance) > 0:
+			reason = TxQueuedInsufficientBalance
+		default:
+			reason = TxQueuedAwaitingPromotion
+		}
+		if !gapped {
+			next++
+		}
+		entries = append(entries, newTxPoolEntry(tx, reason))
+	}
+	return entries
+}
+
+func newTxPoolEntry(tx *types.Transaction, reason string) *TxPoolEntry {
+	return &TxPoolEntry{
+		Hash:     tx.Hash(),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: (*hexutil.Big)(tx.GasPrice()),
+		Cost:     (*hexutil.Big)(tx.Cost()),
+		Reason:   reason,
+	}
+}
+
+// TxPoolInspector 是能够生成内容快照的交易池，TxPool 实现了它。
+type TxPoolInspector interface {
+	Inspect() *TxPoolContent
+}
+
+// Inspect 返回交易池内容按发送者分组的快照，队列交易附带无法执行的原因。
+func (pool *TxPool) Inspect() *TxPoolContent {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return inspectTxPool(pool.pending, pool.queue, pool.currentState)
+}
+
+// APIs 返回交易池提供的 RPC 服务，节点服务把它们加入自己的 API 列表即可在 txpool 命名空间下访问。
+func (pool *TxPool) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "txpool",
+			Version:   "1.0",
+			Service:   NewTxPoolInspectAPI(pool),
+			Public:    true,
+		},
+	}
+}
+
+// TxPoolInspectAPI 通过 RPC 在 txpool 命名空间下提供交易池的分组内容和排队原因。
+type TxPoolInspectAPI struct {
+	pool TxPoolInspector
+}
+
+// NewTxPoolInspectAPI 创建一个新的交易池检查 API。
+func NewTxPoolInspectAPI(pool TxPoolInspector) *TxPoolInspectAPI {
+	return &TxPoolInspectAPI{pool: pool}
+}
+
+// Detail 返回整个交易池按发送者和nonce分组的内容。
+func (api *TxPoolInspectAPI) Detail() *TxPoolContent {
+	return api.pool.Inspect()
+}
+
+// DetailFrom 只返回给定发送者的交易。
+func (api *TxPoolInspectAPI) DetailFrom(addr chain_common.Address) *TxPoolContent {
+	content := api.pool.Inspect()
+	return &TxPoolContent{
+		Pending: map[chain_common.Address][]*TxPoolEntry{addr: content.Pending[addr]},
+		Queued:  map[chain_common.Address][]*TxPoolEntry{addr: content.Queued[addr]},
+	}
+}
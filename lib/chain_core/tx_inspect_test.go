@@ -0,0 +1,96 @@
+package chain_core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+)
+
+// testPoolState 是只有一个账户的 txPoolState。
+type testPoolState struct {
+	nonce   uint64
+	balance *big.Int
+}
+
+func (s *testPoolState) GetNonce(chain_common.Address) uint64     { return s.nonce }
+func (s *testPoolState) GetBalance(chain_common.Address) *big.Int { return s.balance }
+
+func TestInspectQueued(t *testing.T) {
+	// 每笔交易的最大花费是 1000 + 21000，单独看都不超过余额
+	newTx := func(nonce uint64) *types.Transaction {
+		return types.NewTransaction(nonce, chain_common.Address{0x01}, big.NewInt(1000), 21000, big.NewInt(1), nil)
+	}
+	pending, queued := newTxList(true), newTxList(false)
+	pending.Add(newTx(5), DefaultTxPriceBump)
+	for _, nonce := range []uint64{3, 6, 7, 9, 10} {
+		queued.Add(newTx(nonce), DefaultTxPriceBump)
+	}
+	state := &testPoolState{nonce: 5, balance: big.NewInt(50000)}
+
+	want := []struct {
+		nonce  uint64
+		reason string
+	}{
+		{3, TxQueuedStale},
+		{6, TxQueuedAwaitingPromotion},
+		{7, TxQueuedInsufficientBalance}, // 可执行交易和nonce 6 之后余额不足
+		{9, TxQueuedNonceGap},
+		{10, TxQueuedNonceGap},
+	}
+	entries := inspectQueued(chain_common.Address{0xaa}, pending, queued, state)
+	if len(entries) != len(want) {
+		t.Fatalf("条目数量不匹配: 得到 %d, 需要 %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if uint64(entry.Nonce) != want[i].nonce || entry.Reason != want[i].reason {
+			t.Errorf("条目 %d 不匹配: 得到 (%d, %s), 需要 (%d, %s)", i, entry.Nonce, entry.Reason, want[i].nonce, want[i].reason)
+		}
+	}
+	// 没有可执行交易时从账户的nonce开始，余额从零开始扣除
+	entries = inspectQueued(chain_common.Address{0xaa}, nil, queued, &testPoolState{nonce: 6, balance: big.NewInt(50000)})
+	if entries[0].Reason != TxQueuedStale || entries[1].Reason != TxQueuedAwaitingPromotion || entries[2].Reason != TxQueuedAwaitingPromotion {
+		t.Errorf("没有可执行交易时的原因不匹配: %s, %s, %s", entries[0].Reason, entries[1].Reason, entries[2].Reason)
+	}
+}
+
+// testInspector 是返回固定快照的 TxPoolInspector。
+type testInspector struct {
+	content *TxPoolContent
+}
+
+func (i *testInspector) Inspect() *TxPoolContent { return i.content }
+
+func TestTxPoolInspectAPI(t *testing.T) {
+	var (
+		addr  = chain_common.Address{0xaa}
+		other = chain_common.Address{0xbb}
+		newTx = func(nonce uint64) *types.Transaction {
+			return types.NewTransaction(nonce, chain_common.Address{0x01}, big.NewInt(1000), 21000, big.NewInt(1), nil)
+		}
+	)
+	pending, queued := newTxList(true), newTxList(false)
+	pending.Add(newTx(0), DefaultTxPriceBump)
+	queued.Add(newTx(2), DefaultTxPriceBump)
+
+	content := inspectTxPool(
+		map[chain_common.Address]*txList{addr: pending},
+		map[chain_common.Address]*txList{addr: queued},
+		&testPoolState{nonce: 0, balance: big.NewInt(1000000)},
+	)
+	if entries := content.Pending[addr]; len(entries) != 1 || entries[0].Nonce != 0 || entries[0].Reason != "" {
+		t.Errorf("可执行交易不匹配: %+v", entries)
+	}
+	if entries := content.Queued[addr]; len(entries) != 1 || entries[0].Nonce != 2 || entries[0].Reason != TxQueuedNonceGap {
+		t.Errorf("队列交易不匹配: %+v", entries)
+	}
+	// RPC 服务只返回请求的发送者
+	api := NewTxPoolInspectAPI(&testInspector{content})
+	if detail := api.DetailFrom(addr); len(detail.Pending[addr]) != 1 || len(detail.Queued[addr]) != 1 {
+		t.Errorf("发送者的交易不匹配: %+v", detail)
+	}
+	if detail := api.DetailFrom(other); len(detail.Pending[other])+len(detail.Queued[other]) != 0 || len(detail.Pending) != 1 {
+		t.Errorf("其他发送者不应有交易: %+v", detail)
+	}
+}
@@ -0,0 +1,168 @@
+package chain_core
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/logger"
+	"github.com/aidoc/go-aidoc/lib/rlp"
+)
+
+// errNoActiveJournal 在尝试向日志插入交易但当前没有打开的日志文件时返回。
+var errNoActiveJournal = errors.New("没有打开的交易日志")
+
+// devNull 是一个只丢弃写入内容的 WriteCloser，用于在加载日志期间阻止重新写入日志。
+type devNull struct{}
+
+func (*devNull) Write(p []byte) (n int, err error) { return len(p), nil }
+func (*devNull) Close() error                      { return nil }
+
+// txJournal 是一个循环写入的本地交易日志，使本地创建的交易在节点重启后仍然保留在池中。
+type txJournal struct {
+	path   string         // 存储交易的文件系统路径
+	writer io.WriteCloser // 写入新交易的输出流
+}
+
+// newTxJournal 创建一个新的交易日志。
+func newTxJournal(path string) *txJournal {
+	return &txJournal{
+		path: path,
+	}
+}
+
+// load 解析磁盘上的交易日志，并通过 add 把其中的交易按正常的校验流程重新加入交易池。
+//
+// 同一发送者同一nonce的交易以日志中较晚的一笔为准，每个发送者的交易按nonce顺序成批加入，
+// 避免高nonce的交易先进入队列。
+func (journal *txJournal) load(add func([]*types.Transaction) []error) error {
+	// 如果日志不存在，则跳过解析
+	if _, err := os.Stat(journal.path); os.IsNotExist(err) {
+		return nil
+	}
+	input, err := os.Open(journal.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	// 临时丢弃所有日志写入，加入池的交易不应被重复写入
+	journal.writer = new(devNull)
+	defer func() { journal.writer = nil }()
+
+	// 读取日志中的所有交易，按发送者分组
+	var (
+		stream  = rlp.NewStream(input, 0)
+		senders = make(map[chain_common.Address]*txSortedMap)
+		order   []chain_common.Address
+		total   int
+		failure error
+	)
+	for {
+		tx := new(types.Transaction)
+		if err = stream.Decode(tx); err != nil {
+			if err != io.EOF {
+				failure = err
+			}
+			break
+		}
+		total++
+
+		// 日志中的交易此前已通过校验，这里只需要恢复发送者用于分组
+		var signer types.Signer = types.HomesteadSigner{}
+		if tx.Type() != types.LegacyTxType {
+			signer = types.NewTypedTxSigner(tx.ChainId())
+		} else if tx.Protected() {
+			signer = types.NewEIP155Signer(tx.ChainId())
+		}
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			logger.Debug("跳过发送者无效的日志交易", "hash", tx.Hash(), "err", err)
+			continue
+		}
+		if senders[from] == nil {
+			senders[from] = newTxSortedMap()
+			order = append(order, from)
+		}
+		senders[from].Put(tx)
+	}
+	// 按发送者把交易重新加入池
+	var loaded, dropped int
+	for _, from := range order {
+		txs := senders[from].Flatten()
+		for _, err := range add(txs) {
+			if err != nil {
+				logger.Debug("无法添加日志交易", "err", err)
+				dropped++
+			}
+		}
+		loaded += len(txs)
+	}
+	logger.Info("已加载本地交易日志", "transactions", total, "replayed", loaded, "dropped", dropped)
+
+	return failure
+}
+
+// insert 将指定的交易添加到本地磁盘日志中。
+func (journal *txJournal) insert(tx *types.Transaction) error {
+	if journal.writer == nil {
+		return errNoActiveJournal
+	}
+	if err := rlp.Encode(journal.writer, tx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// rotate 根据交易池的当前内容重新生成交易日志，只保留仍在 pending 中的交易。
+func (journal *txJournal) rotate(pending map[chain_common.Address]*txList) error {
+	// 关闭当前打开的日志（如果有）
+	if journal.writer != nil {
+		if err := journal.writer.Close(); err != nil {
+			return err
+		}
+		journal.writer = nil
+	}
+	// 生成一个包含池当前内容的新日志
+	replacement, err := os.OpenFile(journal.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	journaled := 0
+	for _, list := range pending {
+		for _, tx := range list.Flatten() {
+			if err = rlp.Encode(replacement, tx); err != nil {
+				replacement.Close()
+				return err
+			}
+		}
+		journaled += list.Len()
+	}
+	replacement.Close()
+
+	// 用新日志替换旧日志
+	if err = os.Rename(journal.path+".new", journal.path); err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		return err
+	}
+	journal.writer = sink
+	logger.Info("重新生成本地交易日志", "transactions", journaled, "accounts", len(pending))
+
+	return nil
+}
+
+// close 将交易日志内容刷新到磁盘并关闭文件。
+func (journal *txJournal) close() error {
+	var err error
+
+	if journal.writer != nil {
+		err = journal.writer.Close()
+		journal.writer = nil
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package chain_core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+func TestTxJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txjournal")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		signer = types.NewEIP155Signer(big.NewInt(1))
+		key, _ = crypto.GenerateKey()
+		from   = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	sign := func(nonce uint64, price int64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, chain_common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(price), nil), signer, key)
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		return tx
+	}
+	journal := newTxJournal(filepath.Join(dir, "transactions.rlp"))
+
+	// 日志不存在时不加载任何交易
+	if err := journal.load(func(txs []*types.Transaction) []error {
+		t.Fatalf("不应加载交易: %v", txs)
+		return nil
+	}); err != nil {
+		t.Fatalf("无法加载不存在的日志: %v", err)
+	}
+	if err := journal.insert(sign(0, 1)); err != errNoActiveJournal {
+		t.Fatalf("没有打开日志时插入: 得到 %v, 需要 %v", err, errNoActiveJournal)
+	}
+	// 重新生成的日志只包含 pending 中的交易，之后插入的交易追加在后面
+	pending := newTxList(true)
+	pending.Add(sign(1, 1), DefaultTxPriceBump)
+	if err := journal.rotate(map[chain_common.Address]*txList{from: pending}); err != nil {
+		t.Fatalf("无法重新生成日志: %v", err)
+	}
+	replacement := sign(1, 2)
+	for _, tx := range []*types.Transaction{sign(2, 1), sign(0, 1), replacement} {
+		if err := journal.insert(tx); err != nil {
+			t.Fatalf("无法写入日志: %v", err)
+		}
+	}
+	if err := journal.close(); err != nil {
+		t.Fatalf("无法关闭日志: %v", err)
+	}
+	// 同一nonce以较晚写入的交易为准，发送者的交易按nonce顺序成批加入
+	var batches [][]chain_common.Hash
+	err = journal.load(func(txs []*types.Transaction) []error {
+		var hashes []chain_common.Hash
+		for _, tx := range txs {
+			hashes = append(hashes, tx.Hash())
+		}
+		batches = append(batches, hashes)
+		return make([]error, len(txs))
+	})
+	if err != nil {
+		t.Fatalf("无法加载日志: %v", err)
+	}
+	want := [][]chain_common.Hash{{sign(0, 1).Hash(), replacement.Hash(), sign(2, 1).Hash()}}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("加载的交易不匹配: 得到 %x, 需要 %x", batches, want)
+	}
+}
@@ -5,12 +5,25 @@ import (
 	"math"
 	"math/big"
 	"sort"
+	"time"
 
 	"github.com/aidoc/go-aidoc/lib/chain_common"
 	"github.com/aidoc/go-aidoc/lib/chain_core/types"
 	"github.com/aidoc/go-aidoc/lib/logger"
+	"github.com/aidoc/go-aidoc/service/metrics"
 )
 
+// queuedExpiredMeter 统计因超过生存时间而从队列中删除的交易。
+var queuedExpiredMeter = metrics.NewRegisteredMeter("txpool/queued/expired", nil)
+
+// DefaultTxLifetime 是未配置时非本地交易在队列中的最长停留时间。
+const DefaultTxLifetime = 3 * time.Hour
+
+// TxsExpiredEvent 在队列中的交易因超过生存时间被删除时发送。
+type TxsExpiredEvent struct {
+	Txs types.Transactions
+}
+
 // nonceHeap是一个heap.Interface实现，超过64位无符号整数，用于从可能有缺口的未来队列中检索已排序的交易。
 type nonceHeap []uint64
 
@@ -184,14 +197,18 @@ type txList struct {
 
 	costcap *big.Int // 最高成本交易的价格（仅在超出余额时重置）
 	gascap  uint64   // 最高支出交易的 gas 限制（仅在超过限额时重置）
+	bytes   uint64   // 列表中所有交易的载荷总字节数
+
+	arrivals map[chain_common.Hash]time.Time // 每笔交易进入列表的时间
 }
 
 // newTxList创建一个新的交易列表，用于维护可随意索引的快速，有缺口，可排序的交易列表。
 func newTxList(strict bool) *txList {
 	return &txList{
-		strict:  strict,
-		txs:     newTxSortedMap(),
-		costcap: new(big.Int),
+		strict:   strict,
+		txs:      newTxSortedMap(),
+		costcap:  new(big.Int),
+		arrivals: make(map[chain_common.Hash]time.Time),
 	}
 }
 
@@ -208,16 +225,19 @@ func (l *txList) Add(tx *types.Transaction, priceBump uint64) (bool, *types.Tran
 	old := l.txs.Get(tx.Nonce())
 	logger.Info("tx_list.go Add()" , "old" , old)
 	if old != nil {
-		threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(priceBump))), big.NewInt(100))
-		// 必须确保新的 gas 价格高于旧 gas 价格
-		// 价格以及检查百分比阈值以确保这一点
-		// 这对于低（dose 级） gas 价格替代是准确的
-		if old.GasPrice().Cmp(tx.GasPrice()) >= 0 || threshold.Cmp(tx.GasPrice()) > 0 {
+		// 新的费用上限和小费上限都必须高于旧交易，并且达到百分比阈值（旧式交易两者都是 gas 价格）
+		if minReplacementPrice(old.GasFeeCap(), priceBump).Cmp(tx.GasFeeCap()) > 0 ||
+			minReplacementPrice(old.GasTipCap(), priceBump).Cmp(tx.GasTipCap()) > 0 {
 			return false, nil
 		}
 	}
 	// 否则用当前交易覆盖旧交易
 	l.txs.Put(tx)
+	if old != nil {
+		l.forget(types.Transactions{old})
+	}
+	l.bytes += uint64(len(tx.Data()))
+	l.arrivals[tx.Hash()] = time.Now()
 	if cost := tx.Cost(); l.costcap.Cmp(cost) < 0 {
 		l.costcap = cost
 	}
@@ -228,7 +248,7 @@ func (l *txList) Add(tx *types.Transaction, priceBump uint64) (bool, *types.Tran
 }
 // Forward使用低于提供的阈值的nonce从列表中删除所有交易。 对于任何删除后维护，都会返回每个已删除的交易。
 func (l *txList) Forward(threshold uint64) types.Transactions {
-	return l.txs.Forward(threshold)
+	return l.forget(l.txs.Forward(threshold))
 }
 //过滤器从列表中删除所有交易，其成本或gas限制高于提供的阈值。 对于任何删除后维护，都会返回每个已删除的交易。 还返回严格模式的无效交易。
 //
@@ -254,23 +274,41 @@ func (l *txList) Filter(costLimit *big.Int, gasLimit uint64) (types.Transactions
 		}
 		invalids = l.txs.Filter(func(tx *types.Transaction) bool { return tx.Nonce() > lowest })
 	}
-	return removed, invalids
+	return l.forget(removed), l.forget(invalids)
 }
 // Cap对项目数量设置了一个硬限制，返回超过该限制的所有交易。
 func (l *txList) Cap(threshold int) types.Transactions {
-	return l.txs.Cap(threshold)
+	return l.forget(l.txs.Cap(threshold))
+}
+
+// CapBytes 从最高的nonce开始删除交易，直到列表中交易的载荷总字节数不超过 limit，返回被删除的交易。
+func (l *txList) CapBytes(limit uint64) types.Transactions {
+	if l.bytes <= limit {
+		return nil
+	}
+	txs, bytes := l.txs.Flatten(), l.bytes
+
+	keep := len(txs)
+	for keep > 0 && bytes > limit {
+		keep--
+		bytes -= uint64(len(txs[keep].Data()))
+	}
+	return l.Cap(keep)
 }
 
 // Remove从维护列表中删除交易，返回是否找到交易，还返回因删除而无效的任何交易（仅限严格模式）。
 func (l *txList) Remove(tx *types.Transaction) (bool, types.Transactions) {
 	//  从集合中删除交易
 	nonce := tx.Nonce()
+	old := l.txs.Get(nonce)
 	if removed := l.txs.Remove(nonce); !removed {
 		return false, nil
 	}
+	l.forget(types.Transactions{old})
+
 	// 在严格模式下，过滤掉不可执行的交易
 	if l.strict {
-		return true, l.txs.Filter(func(tx *types.Transaction) bool { return tx.Nonce() > nonce })
+		return true, l.forget(l.txs.Filter(func(tx *types.Transaction) bool { return tx.Nonce() > nonce }))
 	}
 	return true, nil
 }
@@ -279,7 +317,7 @@ func (l *txList) Remove(tx *types.Transaction) (bool, types.Transactions) {
 //
 //注意，还会返回所有nonce低于start的交易，以防止进入和无效状态。 这不是应该发生的事情，但更好的是自我纠正而不是失败！
 func (l *txList) Ready(start uint64) types.Transactions {
-	return l.txs.Ready(start)
+	return l.forget(l.txs.Ready(start))
 }
 // Len返回交易列表的长度。
 func (l *txList) Len() int {
@@ -289,92 +327,274 @@ func (l *txList) Len() int {
 func (l *txList) Empty() bool {
 	return l.Len() == 0
 }
+
+// Bytes 返回列表中所有交易的载荷总字节数。
+func (l *txList) Bytes() uint64 {
+	return l.bytes
+}
+
+// Spend 返回列表中所有交易的最大花费（Transaction.Cost）之和。
+func (l *txList) Spend() *big.Int {
+	spend := new(big.Int)
+	for _, tx := range l.txs.Flatten() {
+		spend.Add(spend, tx.Cost())
+	}
+	return spend
+}
+
+// forget 从载荷字节计数和到达时间中清除被删除的交易，并原样返回它们。
+func (l *txList) forget(removed types.Transactions) types.Transactions {
+	for _, tx := range removed {
+		l.bytes -= uint64(len(tx.Data()))
+		delete(l.arrivals, tx.Hash())
+	}
+	return removed
+}
+
+// Expire 删除在 deadline 之前到达的所有交易并返回它们。 在严格模式下，被删除交易之后的交易也会被删除。
+// 没有到达时间的交易视为刚刚到达，不会被删除。
+func (l *txList) Expire(deadline time.Time) (types.Transactions, types.Transactions) {
+	expired := l.txs.Filter(func(tx *types.Transaction) bool {
+		arrived, ok := l.arrivals[tx.Hash()]
+		return ok && arrived.Before(deadline)
+	})
+
+	var invalids types.Transactions
+	if l.strict && len(expired) > 0 {
+		lowest := uint64(math.MaxUint64)
+		for _, tx := range expired {
+			if nonce := tx.Nonce(); lowest > nonce {
+				lowest = nonce
+			}
+		}
+		invalids = l.txs.Filter(func(tx *types.Transaction) bool { return tx.Nonce() > lowest })
+	}
+	return l.forget(expired), l.forget(invalids)
+}
 // Flatten根据松散排序的内部表示创建一个随机数排序的交易片。 如果在对内容进行任何修改之前再次请求，则对缓存的结果进行缓存。
 func (l *txList) Flatten() types.Transactions {
 	return l.txs.Flatten()
 }
-// priceHeap是一个heap.Interface实现的交易，用于检索在池填满时丢弃的价格分类交易。
-type priceHeap []*types.Transaction
+// TxQuotaConfig 是交易池对单个发送者的配额，零值字段表示不限制。 本地账户不受配额限制。
+type TxQuotaConfig struct {
+	AccountPending uint64 // 每个发送者最多可以有的可执行交易数量
+	AccountQueued  uint64 // 每个发送者最多可以有的不可执行交易数量
+	AccountBytes   uint64 // 每个发送者所有交易的载荷总字节数上限
+}
+
+// Enforce 对一个发送者的可执行列表和队列列表执行配额，返回需要从池中删除的交易，两个列表都可以为 nil。
+// 超出配额时总是先删除最新（nonce 最高）的交易：载荷字节超出配额时先从队列列表删除，仍然超出时
+// 再从可执行列表删除。 删除最高的nonce不会使可执行列表中剩余的交易失效。
+func (c *TxQuotaConfig) Enforce(pending, queued *txList) types.Transactions {
+	var drops types.Transactions
+
+	if pending != nil && c.AccountPending > 0 && uint64(pending.Len()) > c.AccountPending {
+		drops = append(drops, pending.Cap(int(c.AccountPending))...)
+	}
+	if queued != nil && c.AccountQueued > 0 && uint64(queued.Len()) > c.AccountQueued {
+		drops = append(drops, queued.Cap(int(c.AccountQueued))...)
+	}
+	if c.AccountBytes > 0 {
+		var pendingBytes, queuedBytes uint64
+		if pending != nil {
+			pendingBytes = pending.Bytes()
+		}
+		if queued != nil {
+			var limit uint64
+			if c.AccountBytes > pendingBytes {
+				limit = c.AccountBytes - pendingBytes
+			}
+			drops = append(drops, queued.CapBytes(limit)...)
+			queuedBytes = queued.Bytes()
+		}
+		if pending != nil {
+			drops = append(drops, pending.CapBytes(c.AccountBytes-queuedBytes)...)
+		}
+	}
+	return drops
+}
+
+// spender 是按花费排序的驱逐候选账户。
+type spender struct {
+	list  *txList
+	spend *big.Int // 列表中剩余交易的花费之和
+}
+
+// spenderHeap 是按花费降序排列的 heap.Interface 实现。
+type spenderHeap []*spender
+
+func (h spenderHeap) Len() int           { return len(h) }
+func (h spenderHeap) Less(i, j int) bool { return h[i].spend.Cmp(h[j].spend) > 0 }
+func (h spenderHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *spenderHeap) Push(x interface{}) {
+	*h = append(*h, x.(*spender))
+}
+
+func (h *spenderHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// evictBiggestSpenders 从 lists 中删除最多 count 笔交易并返回它们。 每次都从剩余花费最多的发送者
+// 删除其nonce最高的交易，然后重新比较花费，因此驱逐首先落在最大的几个账户上。 本地账户不会被驱逐。
+//
+// lists 通常是交易池的队列或可执行映射，调用方负责把返回的交易从池的其余索引中删除。
+func evictBiggestSpenders(lists map[chain_common.Address]*txList, count int, local *accountSet) types.Transactions {
+	spenders := make(spenderHeap, 0, len(lists))
+	for addr, list := range lists {
+		if list.Empty() || local.contains(addr) {
+			continue
+		}
+		spenders = append(spenders, &spender{list: list, spend: list.Spend()})
+	}
+	heap.Init(&spenders)
+
+	drops := make(types.Transactions, 0, count)
+	for len(drops) < count && spenders.Len() > 0 {
+		s := spenders[0]
+
+		txs := s.list.Flatten()
+		newest := txs[len(txs)-1]
+		s.list.Cap(len(txs) - 1)
+		s.spend.Sub(s.spend, newest.Cost())
+
+		drops = append(drops, newest)
+		if s.list.Empty() {
+			heap.Pop(&spenders)
+		} else {
+			heap.Fix(&spenders, 0)
+		}
+	}
+	return drops
+}
+
+// expireQueued 从队列映射中删除到达时间超过 lifetime 的非本地交易并返回它们，同时删除变空的列表。
+// 调用方负责把返回的交易从池的其余索引中删除，并发送 TxsExpiredEvent。
+func expireQueued(queue map[chain_common.Address]*txList, lifetime time.Duration, local *accountSet) types.Transactions {
+	var (
+		deadline = time.Now().Add(-lifetime)
+		expired  types.Transactions
+	)
+	for addr, list := range queue {
+		if local.contains(addr) {
+			continue
+		}
+		drops, invalids := list.Expire(deadline)
+		expired = append(append(expired, drops...), invalids...)
+
+		if list.Empty() {
+			delete(queue, addr)
+		}
+	}
+	if len(expired) > 0 {
+		queuedExpiredMeter.Mark(int64(len(expired)))
+		logger.Debug("删除过期的队列交易", "count", len(expired), "lifetime", lifetime)
+	}
+	return expired
+}
+
+// priceHeap是一个heap.Interface实现的交易，用于检索在池填满时丢弃的价格分类交易。 堆同时维护
+// 交易哈希到堆位置的索引，因此可以在 O(log n) 时间内按哈希删除任意交易。
+//
+// 交易按在当前基础费用下的实际小费排序；动态费用分叉之前基础费用为 nil，实际小费即 gas 价格。
+type priceHeap struct {
+	txs     []*types.Transaction
+	index   map[chain_common.Hash]int // 交易哈希到其在 txs 中位置的映射
+	baseFee *big.Int                  // 计算实际小费使用的基础费用
+}
+
+func (h *priceHeap) Len() int { return len(h.txs) }
 
-func (h priceHeap) Len() int      { return len(h) }
-func (h priceHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *priceHeap) Swap(i, j int) {
+	h.txs[i], h.txs[j] = h.txs[j], h.txs[i]
+	h.index[h.txs[i].Hash()] = i
+	h.index[h.txs[j].Hash()] = j
+}
 
-func (h priceHeap) Less(i, j int) bool {
-	//主要按价格排序，返回更便宜的价格
-	switch h[i].GasPrice().Cmp(h[j].GasPrice()) {
+func (h *priceHeap) Less(i, j int) bool {
+	//主要按实际小费排序，返回更便宜的交易
+	switch h.txs[i].EffectiveGasTip(h.baseFee).Cmp(h.txs[j].EffectiveGasTip(h.baseFee)) {
 	case -1:
 		return true
 	case 1:
 		return false
 	}
 	//如果价格匹配，则通过nonce稳定（高nonce更糟）
-	return h[i].Nonce() > h[j].Nonce()
+	return h.txs[i].Nonce() > h.txs[j].Nonce()
 }
 
 func (h *priceHeap) Push(x interface{}) {
-	*h = append(*h, x.(*types.Transaction))
+	tx := x.(*types.Transaction)
+	h.index[tx.Hash()] = len(h.txs)
+	h.txs = append(h.txs, tx)
 }
 
 func (h *priceHeap) Pop() interface{} {
-	old := *h
+	old := h.txs
 	n := len(old)
 	x := old[n-1]
-	*h = old[0 : n-1]
+	old[n-1] = nil
+	h.txs = old[0 : n-1]
+	delete(h.index, x.Hash())
 	return x
 }
+
 // txPricedList是一个价格排序堆，允许以价格递增的方式对交易池内容进行操作。
 type txPricedList struct {
-	all    *txLookup  // 指向所有交易 map 的指针
-	items  *priceHeap // 所有存储的交易的价格堆
-	stales int        // 过期价格点数（重堆积触发器）
+	items *priceHeap // 所有存储的交易的价格堆
 }
+
 // newTxPricedList 创建一个新的按价格排序的交易堆。
-func newTxPricedList(all *txLookup) *txPricedList {
-	return &txPricedList {
-		all:   all,
-		items: new(priceHeap),
+func newTxPricedList() *txPricedList {
+	return &txPricedList{
+		items: &priceHeap{index: make(map[chain_common.Hash]int)},
 	}
 }
-//将新交易插入堆中。
+
+//将新交易插入堆中。 已经在堆中的交易会被忽略。
 func (l *txPricedList) Put(tx *types.Transaction) {
+	if _, ok := l.items.index[tx.Hash()]; ok {
+		return
+	}
 	heap.Push(l.items, tx)
 }
-// Removed通知价格交易列表旧的交易从池中删除。 该列表将保留一个陈旧对象的计数器，并在足够大的交易比例过时时更新堆。
-func (l *txPricedList) Removed() {
-	// 冲撞过时的计数器，但如果仍然太低（<25％）则退出
-	l.stales++
-	if l.stales <= len(*l.items)/4 {
-		return
+
+// Removed通知价格交易列表旧的交易从池中删除，交易会立即从堆中删除。
+func (l *txPricedList) Removed(tx *types.Transaction) {
+	if i, ok := l.items.index[tx.Hash()]; ok {
+		heap.Remove(l.items, i)
 	}
-	// 似乎我们已经达到了关键数量的陈旧交易，重新调整
-	reheap := make(priceHeap, 0, l.all.Count())
+}
 
-	l.stales, l.items = 0, &reheap
-	l.all.Range(func(hash chain_common.Hash, tx *types.Transaction) bool {
-		*l.items = append(*l.items, tx)
-		return true
-	})
+// Len 返回堆中交易的数量。
+func (l *txPricedList) Len() int {
+	return l.items.Len()
+}
+
+// SetBaseFee 更新计算实际小费使用的基础费用并重建堆。 交易池应在每个新的链头调用它。
+func (l *txPricedList) SetBaseFee(baseFee *big.Int) {
+	l.items.baseFee = baseFee
 	heap.Init(l.items)
 }
 
-// Cap 找到低于给定价格阈值的所有交易，将它们从定价列表中删除，然后重新将它们从整个池中删除。
+// Cap 找到实际小费低于给定价格阈值的所有交易，将它们从定价列表中删除，然后重新将它们从整个池中删除。
 func (l *txPricedList) Cap(threshold *big.Int, local *accountSet) types.Transactions {
 	drop := make(types.Transactions, 0, 128) // Remote underpriced transactions to drop
 	save := make(types.Transactions, 0, 64)  // Local underpriced transactions to keep
 
-	for len(*l.items) > 0 {
-		//如果在清理过程中发现，则丢弃陈旧的交易
-		tx := heap.Pop(l.items).(*types.Transaction)
-		if l.all.Get(tx.Hash()) == nil {
-			l.stales--
-			continue
-		}
+	for l.items.Len() > 0 {
 		//如果达到阈值，请停止丢弃
-		if tx.GasPrice().Cmp(threshold) >= 0 {
-			save = append(save, tx)
+		tx := l.items.txs[0]
+		if tx.EffectiveGasTip(l.items.baseFee).Cmp(threshold) >= 0 {
 			break
 		}
-		//找到非陈旧的交易，除非是本地的，否则丢弃
+		heap.Pop(l.items)
+
+		//除非是本地的，否则丢弃
 		if local.containsTx(tx) {
 			save = append(save, tx)
 		} else {
@@ -393,37 +613,23 @@ func (l *txPricedList) Underpriced(tx *types.Transaction, local *accountSet) boo
 	if local.containsTx(tx) {
 		return false
 	}
-	//如果在堆开始时找到陈旧的价格点，则丢弃
-	for len(*l.items) > 0 {
-		head := []*types.Transaction(*l.items)[0]
-		if l.all.Get(head.Hash()) == nil {
-			l.stales--
-			heap.Pop(l.items)
-			continue
-		}
-		break
-	}
 	//检查交易是否定价过低
-	if len(*l.items) == 0 {
+	if l.items.Len() == 0 {
 		logger.Error("查询定价池为空") // 这不可能发生，打印以捕获编程错误
 		return false
 	}
-	cheapest := []*types.Transaction(*l.items)[0]
-	return cheapest.GasPrice().Cmp(tx.GasPrice()) >= 0
+	cheapest := l.items.txs[0]
+	return cheapest.EffectiveGasTip(l.items.baseFee).Cmp(tx.EffectiveGasTip(l.items.baseFee)) >= 0
 }
+
 // Discard发现了许多价格最低的交易，将它们从定价列表中删除并返回它们以便从整个池中进一步删除。
 func (l *txPricedList) Discard(count int, local *accountSet) types.Transactions {
 	drop := make(types.Transactions, 0, count) // 远程低价交易下降
 	save := make(types.Transactions, 0, 64)    // 本地低价交易保持不变
 
-	for len(*l.items) > 0 && count > 0 {
-		// 如果在清理过程中发现，则丢弃陈旧的交易
+	for l.items.Len() > 0 && count > 0 {
+		// 找到最便宜的交易，除非是本地的，否则丢弃
 		tx := heap.Pop(l.items).(*types.Transaction)
-		if l.all.Get(tx.Hash()) == nil {
-			l.stales--
-			continue
-		}
-		// 找到非陈旧的交易，除非是本地的，否则丢弃
 		if local.containsTx(tx) {
 			save = append(save, tx)
 		} else {
@@ -0,0 +1,221 @@
+package chain_core
+
+import (
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+)
+
+// newPricedTransactions 创建 n 笔nonce从 base 开始、gas 价格随机的未签名交易，价格堆只依赖价格、nonce和哈希。
+func newPricedTransactions(base uint64, n int, rnd *rand.Rand) types.Transactions {
+	txs := make(types.Transactions, n)
+	for i := range txs {
+		txs[i] = types.NewTransaction(base+uint64(i), chain_common.Address{}, big.NewInt(0), 21000, big.NewInt(rnd.Int63n(1000000)+1), nil)
+		txs[i].Hash() // 预先缓存哈希，避免计入基准
+	}
+	return txs
+}
+
+func TestPricedListRemoved(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	txs := newPricedTransactions(0, 1000, rnd)
+
+	priced := newTxPricedList()
+	for _, tx := range txs {
+		priced.Put(tx)
+	}
+	// 随机删除一半交易，剩余的交易必须按价格顺序弹出
+	removed := make(map[chain_common.Hash]bool)
+	for _, i := range rnd.Perm(len(txs))[:len(txs)/2] {
+		priced.Removed(txs[i])
+		removed[txs[i].Hash()] = true
+	}
+	if priced.Len() != len(txs)-len(removed) {
+		t.Fatalf("堆大小不匹配: 得到 %d, 需要 %d", priced.Len(), len(txs)-len(removed))
+	}
+	var last *big.Int
+	for priced.Len() > 0 {
+		tx := priced.items.txs[0]
+		priced.Removed(tx)
+
+		if removed[tx.Hash()] {
+			t.Fatalf("已删除的交易 %x 仍在堆中", tx.Hash())
+		}
+		if last != nil && last.Cmp(tx.GasPrice()) > 0 {
+			t.Fatalf("价格顺序错误: %v 在 %v 之后", tx.GasPrice(), last)
+		}
+		last = tx.GasPrice()
+	}
+	if len(priced.items.index) != 0 {
+		t.Fatalf("索引未清空: 剩余 %d 项", len(priced.items.index))
+	}
+}
+
+func TestTxListExpire(t *testing.T) {
+	list := newTxList(false)
+	txs := newPricedTransactions(0, 3, rand.New(rand.NewSource(1)))
+	for _, tx := range txs {
+		list.Add(tx, DefaultTxPriceBump)
+	}
+	// 第一笔交易早已到达，第二笔没有到达时间（视为刚刚到达），第三笔刚刚到达
+	list.arrivals[txs[0].Hash()] = time.Now().Add(-time.Hour)
+	delete(list.arrivals, txs[1].Hash())
+
+	expired, _ := list.Expire(time.Now().Add(-time.Minute))
+	if len(expired) != 1 || expired[0] != txs[0] {
+		t.Fatalf("过期交易不匹配: %v", expired)
+	}
+	if list.Len() != 2 {
+		t.Fatalf("剩余交易数量不匹配: 得到 %d, 需要 2", list.Len())
+	}
+}
+
+func TestExpireQueued(t *testing.T) {
+	var (
+		remote = chain_common.Address{0x01}
+		fresh  = chain_common.Address{0x02}
+		local  = chain_common.Address{0x03}
+	)
+	locals := newAccountSet(types.HomesteadSigner{})
+	locals.add(local)
+
+	queue := map[chain_common.Address]*txList{
+		remote: newNonceList(false, 1, 0, 2, 3),
+		fresh:  newNonceList(false, 1, 0, 5),
+		local:  newNonceList(false, 1, 0, 7),
+	}
+	for _, addr := range []chain_common.Address{remote, local} {
+		for hash := range queue[addr].arrivals {
+			queue[addr].arrivals[hash] = time.Now().Add(-time.Hour)
+		}
+	}
+	// 只有远程账户超过生存时间的交易被删除，变空的列表也被删除
+	expired := expireQueued(queue, time.Minute, locals)
+	if len(expired) != 2 {
+		t.Errorf("过期交易数量不匹配: 得到 %d, 需要 2", len(expired))
+	}
+	if _, ok := queue[remote]; ok {
+		t.Errorf("变空的列表没有被删除")
+	}
+	if queue[fresh].Len() != 1 || queue[local].Len() != 1 {
+		t.Errorf("未过期或本地的交易被删除: %v, %v", listNonces(queue[fresh]), listNonces(queue[local]))
+	}
+}
+
+// newNonceList 创建包含给定nonce的交易列表，每笔交易带 size 字节载荷，gas 价格为 price。
+func newNonceList(strict bool, price int64, size int, nonces ...uint64) *txList {
+	list := newTxList(strict)
+	for _, nonce := range nonces {
+		list.Add(types.NewTransaction(nonce, chain_common.Address{}, big.NewInt(0), 100000, big.NewInt(price), make([]byte, size)), DefaultTxPriceBump)
+	}
+	return list
+}
+
+// listNonces 返回列表中交易的nonce，列表为 nil 时返回 nil。
+func listNonces(list *txList) []uint64 {
+	var nonces []uint64
+	if list != nil {
+		for _, tx := range list.Flatten() {
+			nonces = append(nonces, tx.Nonce())
+		}
+	}
+	return nonces
+}
+
+func TestTxQuotaEnforce(t *testing.T) {
+	tests := []struct {
+		quota           TxQuotaConfig
+		pending, queued []uint64
+		size            int
+		wantPending     []uint64
+		wantQueued      []uint64
+	}{
+		// 数量超出配额时从nonce最高的开始删除
+		{TxQuotaConfig{AccountPending: 2, AccountQueued: 2}, []uint64{0, 1, 2, 3}, []uint64{5, 6, 7, 8}, 0, []uint64{0, 1}, []uint64{5, 6}},
+		// 零值不限制
+		{TxQuotaConfig{}, []uint64{0, 1, 2}, []uint64{5}, 100, []uint64{0, 1, 2}, []uint64{5}},
+		// 载荷字节超出配额时先删除队列交易，再删除可执行交易
+		{TxQuotaConfig{AccountBytes: 250}, []uint64{0, 1, 2}, []uint64{5}, 100, []uint64{0, 1}, nil},
+		{TxQuotaConfig{AccountBytes: 350}, []uint64{0, 1}, []uint64{5, 6}, 100, []uint64{0, 1}, []uint64{5}},
+	}
+	for i, test := range tests {
+		pending := newNonceList(true, 1, test.size, test.pending...)
+		queued := newNonceList(false, 1, test.size, test.queued...)
+
+		drops := test.quota.Enforce(pending, queued)
+		if have, want := listNonces(pending), test.wantPending; !reflect.DeepEqual(have, want) {
+			t.Errorf("测试 %d: 可执行交易不匹配: 得到 %v, 需要 %v", i, have, want)
+		}
+		if have, want := listNonces(queued), test.wantQueued; !reflect.DeepEqual(have, want) {
+			t.Errorf("测试 %d: 队列交易不匹配: 得到 %v, 需要 %v", i, have, want)
+		}
+		if have, want := len(drops), len(test.pending)+len(test.queued)-len(test.wantPending)-len(test.wantQueued); have != want {
+			t.Errorf("测试 %d: 删除的交易数量不匹配: 得到 %d, 需要 %d", i, have, want)
+		}
+	}
+	// 任一列表都可以为 nil
+	quota := TxQuotaConfig{AccountPending: 1, AccountQueued: 1, AccountBytes: 100}
+	if drops := quota.Enforce(nil, newNonceList(false, 1, 100, 5, 6)); len(drops) != 1 || drops[0].Nonce() != 6 {
+		t.Errorf("只有队列时删除的交易不匹配: %v", drops)
+	}
+}
+
+func TestEvictBiggestSpenders(t *testing.T) {
+	var (
+		whale = chain_common.Address{0x01}
+		small = chain_common.Address{0x02}
+		local = chain_common.Address{0x03}
+	)
+	locals := newAccountSet(types.HomesteadSigner{})
+	locals.add(local)
+
+	lists := map[chain_common.Address]*txList{
+		whale: newNonceList(false, 10, 0, 1, 2, 3),
+		small: newNonceList(false, 1, 0, 1),
+		local: newNonceList(false, 100, 0, 1, 2),
+	}
+	// 花费最多的远程账户先被驱逐，每次驱逐其nonce最高的交易；本地账户花费最高也不会被驱逐
+	var evicted []uint64
+	for _, tx := range evictBiggestSpenders(lists, 3, locals) {
+		evicted = append(evicted, tx.Nonce())
+	}
+	if !reflect.DeepEqual(evicted, []uint64{3, 2, 1}) {
+		t.Errorf("驱逐的交易不匹配: 得到 %v, 需要 [3 2 1]", evicted)
+	}
+	if !lists[whale].Empty() || lists[small].Len() != 1 || lists[local].Len() != 2 {
+		t.Errorf("驱逐后的列表不匹配: %v, %v, %v", listNonces(lists[whale]), listNonces(lists[small]), listNonces(lists[local]))
+	}
+	// 可以驱逐的交易不足 count 笔时只驱逐远程交易
+	if drops := evictBiggestSpenders(lists, 5, locals); len(drops) != 1 || lists[local].Len() != 2 {
+		t.Errorf("驱逐的交易数量不匹配: 得到 %d, 需要 1", len(drops))
+	}
+}
+
+// BenchmarkPricedListChurn 在保持 100k 笔交易的价格堆上测量一次删除加一次插入的开销。
+func BenchmarkPricedListChurn(b *testing.B) {
+	const size = 100000
+
+	rnd := rand.New(rand.NewSource(1))
+	txs := newPricedTransactions(0, size, rnd)
+	spare := newPricedTransactions(size, size, rnd)
+
+	priced := newTxPricedList()
+	for _, tx := range txs {
+		priced.Put(tx)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		j := rnd.Intn(size)
+
+		priced.Removed(txs[j])
+		txs[j], spare[j] = spare[j], txs[j]
+		priced.Put(txs[j])
+	}
+}
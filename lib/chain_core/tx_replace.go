@@ -0,0 +1,78 @@
+package chain_core
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+)
+
+// ErrNoReplaceableTx 在交易池中没有给定发送者和nonce的交易、因而无法取消时返回。
+var ErrNoReplaceableTx = errors.New("交易池中没有可以取消的交易")
+
+// DefaultTxPriceBump 是未配置时替换交易所需的最低 gas 价格涨幅（百分比）。
+const DefaultTxPriceBump = 10
+
+// TxReplacedEvent 在交易池中的交易被同一发送者、同一nonce的更高价交易替换时发送。
+type TxReplacedEvent struct {
+	Old *types.Transaction // 被替换的交易
+	New *types.Transaction // 替换后的交易
+}
+
+// TxReplaceConfig 是交易池替换同一发送者、同一nonce交易的规则。
+type TxReplaceConfig struct {
+	PriceBump uint64 // 替换已有交易所需的最低 gas 价格涨幅（百分比）
+}
+
+// sanitize 检查替换规则，零值替换为默认值。
+func (c TxReplaceConfig) sanitize() TxReplaceConfig {
+	if c.PriceBump == 0 {
+		c.PriceBump = DefaultTxPriceBump
+	}
+	return c
+}
+
+// minReplacementPrice 返回替换 gas 价格为 old 的交易所需的最低价格：既要比 old 至少高 priceBump 百分比，
+// 也要严格高于 old，后者对极低的价格才有意义。
+func minReplacementPrice(old *big.Int, priceBump uint64) *big.Int {
+	threshold := new(big.Int).Mul(old, new(big.Int).SetUint64(100+priceBump))
+	threshold.Div(threshold, big.NewInt(100))
+
+	if threshold.Cmp(old) <= 0 {
+		threshold.Add(old, chain_common.Big1)
+	}
+	return threshold
+}
+
+// NewCancelTransaction 构造一笔取消 old 的未签名交易：从 from 向自己转账 0，使用与 old 相同的类型和nonce、
+// 最低的转账 gas 以及满足替换规则的最低费用。 动态费用交易的费用上限和小费上限都按替换规则提高，
+// 代付gas的交易沿用 old 的代付账户，签名后还需要代付账户重新签名。 签名后提交到交易池即可替换 old。
+func NewCancelTransaction(old *types.Transaction, from chain_common.Address, priceBump uint64) *types.Transaction {
+	price := minReplacementPrice(old.GasPrice(), priceBump)
+
+	switch old.Type() {
+	case types.AccessListTxType:
+		return types.NewAccessListTransaction(old.ChainId(), old.Nonce(), &from, new(big.Int), configs.TxGas, price, nil, nil)
+	case types.DynamicFeeTxType:
+		tipCap := minReplacementPrice(old.GasTipCap(), priceBump)
+		return types.NewDynamicFeeTransaction(old.ChainId(), old.Nonce(), &from, new(big.Int), configs.TxGas, tipCap, price, nil, nil)
+	case types.FeePayerTxType:
+		return types.NewFeePayerTransaction(old.ChainId(), old.Nonce(), &from, new(big.Int), configs.TxGas, price, nil, *old.FeePayerAddress())
+	}
+	return types.NewTransaction(old.Nonce(), from, new(big.Int), configs.TxGas, price, nil)
+}
+
+// cancelTransaction 在交易池的可执行映射和队列映射中查找 from 的第 nonce 笔交易，并构造取消它的交易。
+// 调用方必须持有交易池的锁。
+func cancelTransaction(pending, queue map[chain_common.Address]*txList, from chain_common.Address, nonce uint64, priceBump uint64) (*types.Transaction, error) {
+	for _, lists := range []map[chain_common.Address]*txList{pending, queue} {
+		if list := lists[from]; list != nil {
+			if old := list.txs.Get(nonce); old != nil {
+				return NewCancelTransaction(old, from, priceBump), nil
+			}
+		}
+	}
+	return nil, ErrNoReplaceableTx
+}
@@ -0,0 +1,81 @@
+package chain_core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+)
+
+func TestNewCancelTransaction(t *testing.T) {
+	var (
+		chainID = big.NewInt(1)
+		from    = chain_common.Address{0xaa}
+		to      = chain_common.Address{0x01}
+		payer   = chain_common.Address{0xbb}
+	)
+	olds := []*types.Transaction{
+		types.NewTransaction(3, to, big.NewInt(1), 50000, big.NewInt(100), nil),
+		types.NewAccessListTransaction(chainID, 3, &to, big.NewInt(1), 50000, big.NewInt(100), nil, types.AccessList{{Address: to}}),
+		types.NewDynamicFeeTransaction(chainID, 3, &to, big.NewInt(1), 50000, big.NewInt(20), big.NewInt(100), nil, nil),
+		types.NewFeePayerTransaction(chainID, 3, &to, big.NewInt(1), 50000, big.NewInt(100), nil, payer),
+	}
+	for _, old := range olds {
+		cancel := NewCancelTransaction(old, from, DefaultTxPriceBump)
+
+		if cancel.Type() != old.Type() || cancel.Nonce() != old.Nonce() {
+			t.Errorf("类型 %d: 取消交易的类型或nonce不匹配: 得到 (%d, %d)", old.Type(), cancel.Type(), cancel.Nonce())
+		}
+		if cancel.To() == nil || *cancel.To() != from || cancel.Value().Sign() != 0 || cancel.Gas() != configs.TxGas {
+			t.Errorf("类型 %d: 取消交易不是向自己的空转账: %v", old.Type(), cancel)
+		}
+		if old.Type() != types.LegacyTxType && cancel.ChainId().Cmp(chainID) != 0 {
+			t.Errorf("类型 %d: 链ID不匹配: 得到 %v, 需要 %v", old.Type(), cancel.ChainId(), chainID)
+		}
+		if want := minReplacementPrice(old.GasFeeCap(), DefaultTxPriceBump); cancel.GasFeeCap().Cmp(want) != 0 {
+			t.Errorf("类型 %d: 费用上限不匹配: 得到 %v, 需要 %v", old.Type(), cancel.GasFeeCap(), want)
+		}
+		if want := minReplacementPrice(old.GasTipCap(), DefaultTxPriceBump); cancel.GasTipCap().Cmp(want) != 0 {
+			t.Errorf("类型 %d: 小费上限不匹配: 得到 %v, 需要 %v", old.Type(), cancel.GasTipCap(), want)
+		}
+		if old.Type() == types.FeePayerTxType {
+			if addr := cancel.FeePayerAddress(); addr == nil || *addr != payer {
+				t.Errorf("代付账户不匹配: 得到 %v, 需要 %x", addr, payer)
+			}
+		}
+		// 交易列表接受取消交易作为替换
+		list := newTxList(true)
+		list.Add(old, DefaultTxPriceBump)
+		if inserted, replaced := list.Add(cancel, DefaultTxPriceBump); !inserted || replaced != old {
+			t.Errorf("类型 %d: 取消交易没有替换原交易", old.Type())
+		}
+	}
+}
+
+func TestCancelTransaction(t *testing.T) {
+	var (
+		from = chain_common.Address{0xaa}
+		to   = chain_common.Address{0x01}
+	)
+	pending, queued := newTxList(true), newTxList(false)
+	pending.Add(types.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1), nil), DefaultTxPriceBump)
+	queued.Add(types.NewTransaction(2, to, big.NewInt(1), 21000, big.NewInt(1), nil), DefaultTxPriceBump)
+
+	var (
+		pendings = map[chain_common.Address]*txList{from: pending}
+		queues   = map[chain_common.Address]*txList{from: queued}
+	)
+	for _, nonce := range []uint64{0, 2} {
+		if cancel, err := cancelTransaction(pendings, queues, from, nonce, DefaultTxPriceBump); err != nil || cancel.Nonce() != nonce {
+			t.Errorf("nonce %d: 无法取消交易: %v", nonce, err)
+		}
+	}
+	if _, err := cancelTransaction(pendings, queues, from, 1, DefaultTxPriceBump); err != ErrNoReplaceableTx {
+		t.Errorf("不存在的交易: 得到 %v, 需要 %v", err, ErrNoReplaceableTx)
+	}
+	if _, err := cancelTransaction(pendings, queues, to, 0, DefaultTxPriceBump); err != ErrNoReplaceableTx {
+		t.Errorf("其他发送者: 得到 %v, 需要 %v", err, ErrNoReplaceableTx)
+	}
+}
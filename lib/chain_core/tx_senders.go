@@ -0,0 +1,10 @@
+package chain_core
+
+import "github.com/aidoc/go-aidoc/lib/chain_core/types"
+
+// recoverSenders 并行恢复 txs 的发送者和代付账户并填充交易的缓存，addTxs 应在获取 pool.mu 之前调用它，
+// 之后持锁校验交易时 types.Sender 和 types.FeePayer 直接命中缓存，不再在锁内逐笔恢复签名。
+// pool.signer 创建后不再改变，因此调用时不需要持锁。 签名无效的交易在这里不报告错误，仍由持锁的校验拒绝。
+func (pool *TxPool) recoverSenders(txs []*types.Transaction) {
+	types.RecoverSenders(pool.signer, txs)
+}
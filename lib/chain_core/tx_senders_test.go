@@ -0,0 +1,71 @@
+package chain_core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/state"
+	"github.com/aidoc/go-aidoc/service/db_model"
+)
+
+func BenchmarkPoolAdmitSerial(b *testing.B) {
+	benchmarkPoolAdmit(b, false)
+}
+
+func BenchmarkPoolAdmitRecovered(b *testing.B) {
+	benchmarkPoolAdmit(b, true)
+}
+
+// benchmarkPoolAdmit 测量交易池接受一批（1000 笔）远程交易的耗时：持有 pool.mu 恢复发送者并检查余额。
+// recovered 为 true 时先在锁外调用 recoverSenders。
+func benchmarkPoolAdmit(b *testing.B, recovered bool) {
+	var (
+		signer     = types.NewEIP155Signer(big.NewInt(1))
+		pool       = &TxPool{signer: signer}
+		keys       = make([]*ecdsa.PrivateKey, 16)
+		txs        = make([]*types.Transaction, 1000)
+		statedb, _ = state.New(chain_common.Hash{}, state.NewDatabase(db_model.NewMemDatabase()))
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		statedb.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000))
+	}
+	for i := range txs {
+		tx, err := types.SignTx(types.NewTransaction(uint64(i), chain_common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil), signer, keys[i%len(keys)])
+		if err != nil {
+			b.Fatalf("无法签名交易: %v", err)
+		}
+		txs[i] = tx
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// 每轮使用没有缓存发送者的新交易，与刚从网络收到的交易相同
+		b.StopTimer()
+		batch := make([]*types.Transaction, len(txs))
+		for j, tx := range txs {
+			blob, _ := tx.MarshalBinary()
+			batch[j] = new(types.Transaction)
+			batch[j].UnmarshalBinary(blob)
+		}
+		b.StartTimer()
+
+		if recovered {
+			pool.recoverSenders(batch)
+		}
+		pool.mu.Lock()
+		for _, tx := range batch {
+			from, err := types.Sender(pool.signer, tx)
+			if err != nil {
+				b.Fatalf("无法恢复发送者: %v", err)
+			}
+			if err := validateTxFunds(pool.signer, tx, from, statedb, nil); err != nil {
+				b.Fatalf("余额检查失败: %v", err)
+			}
+		}
+		pool.mu.Unlock()
+	}
+}
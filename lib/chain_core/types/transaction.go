@@ -20,9 +20,12 @@ var (
 )
 
 // deriveSigner 对使用哪个签名者进行*最佳*猜测。
-//获得签名
-func deriveSigner(V *big.Int) Signer {
-	if V.Sign() != 0 && isProtectedV(V) {
+//获得签名。 类型化交易总是使用 TypedTxSigner，旧式交易根据 V 判断是否受重放保护。
+func deriveSigner(tx *Transaction) Signer {
+	if tx.typ != LegacyTxType {
+		return NewTypedTxSigner(tx.chainID)
+	}
+	if V := tx.data.V; V.Sign() != 0 && isProtectedV(V) {
 		return NewEIP155Signer(deriveChainId(V))
 	} else {
 		return HomesteadSigner{}
@@ -31,11 +34,20 @@ func deriveSigner(V *big.Int) Signer {
 
 //交易的数据结构定义
 type Transaction struct {
+	typ  uint8 // 交易类型，LegacyTxType 表示旧式交易
 	data txdata
+
+	// 类型化交易的附加字段
+	chainID    *big.Int   // 签名所属的链 ID（旧式交易由 V 推导）
+	accessList AccessList // 访问列表（AccessListTxType、DynamicFeeTxType）
+	tipCap     *big.Int   // 小费上限（DynamicFeeTxType），费用上限保存在 data.Price 中
+	feePayer   *feePayer  // 代付gas的账户及其签名（FeePayerTxType）
+
 	// caches
 	hash atomic.Value
 	size atomic.Value
 	from atomic.Value
+	payer atomic.Value
 }
 
 /**
@@ -105,11 +117,17 @@ func newTransaction(nonce uint64, to *chain_common.Address, amount *big.Int, gas
 }
 // ChainId返回此交易签名的链ID（如果有的话）
 func (tx *Transaction) ChainId() *big.Int {
+	if tx.typ != LegacyTxType {
+		return new(big.Int).Set(tx.chainID)
+	}
 	return deriveChainId(tx.data.V)
 }
 //受保护的返回是否保护交易不受重播保护。
 func (tx *Transaction) Protected() bool {
 	logger.Info("transaction.go Protected()" , "tx.data.V" , tx.data.V)
+	if tx.typ != LegacyTxType {
+		return true
+	}
 	return isProtectedV(tx.data.V)
 }
 
@@ -121,26 +139,54 @@ func isProtectedV(V *big.Int) bool {
 	// 任何不是 27或 28的东西都被认为是不受保护的
 	return true
 }
-// EncodeRLP实现了rlp.Encoder
+// EncodeRLP实现了rlp.Encoder。 旧式交易编码为 RLP 列表，类型化交易编码为包含类型字节和内容的 RLP 字符串。
 func (tx *Transaction) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, &tx.data)
+	if tx.typ == LegacyTxType {
+		return rlp.Encode(w, &tx.data)
+	}
+	enc, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, enc)
 }
 // EncodeRLP 实现了rlp.Encoder
 func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
-	_, size, _ := s.Kind()
-	err := s.Decode(&tx.data)
-	if err == nil {
-		tx.size.Store(chain_common.StorageSize(rlp.ListSize(size)))
+	kind, size, err := s.Kind()
+	if err != nil {
+		return err
 	}
-
-	return err
+	if kind == rlp.List {
+		var data txdata
+		if err = s.Decode(&data); err == nil {
+			*tx = Transaction{data: data}
+			tx.size.Store(chain_common.StorageSize(rlp.ListSize(size)))
+		}
+		return err
+	}
+	// 类型化交易包装在 RLP 字符串中
+	enc, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	dec, err := decodeTypedTx(enc)
+	if err != nil {
+		return err
+	}
+	*tx = *dec
+	return nil
 }
 // MarshalJSON编码web3 RPC交易格式。
 func (tx *Transaction) MarshalJSON() ([]byte, error) {
 	hash := tx.Hash()
 	data := tx.data
 	data.Hash = &hash
-	return data.MarshalJSON()
+
+	enc, err := data.MarshalJSON()
+	if err != nil || tx.typ == LegacyTxType {
+		return enc, err
+	}
+	return tx.marshalTypedJSON(enc)
 }
 // UnmarshalJSON解码web3 RPC交易格式。
 func (tx *Transaction) UnmarshalJSON(input []byte) error {
@@ -148,6 +194,12 @@ func (tx *Transaction) UnmarshalJSON(input []byte) error {
 	if err := dec.UnmarshalJSON(input); err != nil {
 		return err
 	}
+	if typed, err := unmarshalTypedJSON(input, dec); typed != nil || err != nil {
+		if err == nil {
+			*tx = *typed
+		}
+		return err
+	}
 	var V byte
 	if isProtectedV(dec.V) {
 		chainID := deriveChainId(dec.V).Uint64()
@@ -190,7 +242,12 @@ func (tx *Transaction) Hash() chain_common.Hash {
 	if hash := tx.hash.Load(); hash != nil {
 		return hash.(chain_common.Hash)
 	}
-	v := rlpHash(tx)
+	var v chain_common.Hash
+	if tx.typ == LegacyTxType {
+		v = rlpHash(tx)
+	} else {
+		v = tx.typedHash()
+	}
 	tx.hash.Store(v)
 	return v
 }
@@ -200,7 +257,11 @@ func (tx *Transaction) Size() chain_common.StorageSize {
 		return size.(chain_common.StorageSize)
 	}
 	c := writeCounter(0)
-	rlp.Encode(&c, &tx.data)
+	if tx.typ == LegacyTxType {
+		rlp.Encode(&c, &tx.data)
+	} else if enc, err := tx.MarshalBinary(); err == nil {
+		c = writeCounter(len(enc))
+	}
 	tx.size.Store(chain_common.StorageSize(c))
 	return chain_common.StorageSize(c)
 }
@@ -232,17 +293,33 @@ func (tx *Transaction) WithSignature(signer Signer, sig []byte) (*Transaction, e
 	if err != nil {
 		return nil, err
 	}
-	cpy := &Transaction{data: tx.data}
+	cpy := &Transaction{typ: tx.typ, data: tx.data, chainID: tx.chainID, accessList: tx.accessList, tipCap: tx.tipCap, feePayer: tx.feePayer}
 	cpy.data.R, cpy.data.S, cpy.data.V = r, s, v
 	return cpy, nil
 }
-//成本回报金额+ gasprice * gaslimit。
+//成本回报发送者需要支付的金额：金额+ gasprice * gaslimit。 代付gas的交易只返回金额，gas 费用见 FeePayerCost。
 func (tx *Transaction) Cost() *big.Int {
-	total := new(big.Int).Mul(tx.data.Price, new(big.Int).SetUint64(tx.data.GasLimit))
+	if tx.typ == FeePayerTxType {
+		return new(big.Int).Set(tx.data.Amount)
+	}
+	total := tx.gasCost()
 	total.Add(total, tx.data.Amount)
 	return total
 }
 
+// FeePayerCost 返回代付账户最多需要支付的 gas 费用 gasprice * gaslimit，其他交易返回 0。
+func (tx *Transaction) FeePayerCost() *big.Int {
+	if tx.typ != FeePayerTxType {
+		return new(big.Int)
+	}
+	return tx.gasCost()
+}
+
+// gasCost 返回 gasprice * gaslimit。
+func (tx *Transaction) gasCost() *big.Int {
+	return new(big.Int).Mul(tx.data.Price, new(big.Int).SetUint64(tx.data.GasLimit))
+}
+
 func (tx *Transaction) RawSignatureValues() (*big.Int, *big.Int, *big.Int) {
 	return tx.data.V, tx.data.R, tx.data.S
 }
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+)
+
+// dynamicFeeTxdata 是 DynamicFeeTxType 交易在类型字节之后的 RLP 内容。 签名的 V 只取 0 或 1。
+type dynamicFeeTxdata struct {
+	ChainID      *big.Int
+	AccountNonce uint64
+	GasTipCap    *big.Int // 每单位gas愿意支付给 coinbase 的最高小费
+	GasFeeCap    *big.Int // 每单位gas愿意支付的最高总费用（基础费用加小费）
+	GasLimit     uint64
+	Recipient    *chain_common.Address `rlp:"nil"`
+	Amount       *big.Int
+	Payload      []byte
+	AccessList   AccessList
+	V, R, S      *big.Int
+}
+
+// NewDynamicFeeTransaction 创建一笔未签名的费用上限/小费交易。 to 为 nil 表示创建合约。
+//
+// 交易实际支付的gas价格为 min(gasFeeCap, 基础费用 + gasTipCap)，其中基础费用部分被销毁，其余部分归 coinbase。
+func NewDynamicFeeTransaction(chainID *big.Int, nonce uint64, to *chain_common.Address, amount *big.Int, gasLimit uint64, gasTipCap, gasFeeCap *big.Int, data []byte, accessList AccessList) *Transaction {
+	tx := newTransaction(nonce, to, amount, gasLimit, gasFeeCap, data)
+	tx.typ = DynamicFeeTxType
+	tx.chainID = new(big.Int).Set(chainID)
+	tx.accessList = copyAccessList(accessList)
+	tx.tipCap = new(big.Int)
+	if gasTipCap != nil {
+		tx.tipCap.Set(gasTipCap)
+	}
+	return tx
+}
+
+// GasTipCap 返回交易每单位gas愿意支付给 coinbase 的最高小费。 其他类型的交易返回gas价格。
+func (tx *Transaction) GasTipCap() *big.Int {
+	if tx.typ == DynamicFeeTxType {
+		return new(big.Int).Set(tx.tipCap)
+	}
+	return new(big.Int).Set(tx.data.Price)
+}
+
+// GasFeeCap 返回交易每单位gas愿意支付的最高总费用。 其他类型的交易返回gas价格。
+func (tx *Transaction) GasFeeCap() *big.Int {
+	return new(big.Int).Set(tx.data.Price)
+}
+
+// EffectiveGasTip 返回在给定基础费用下交易每单位gas实际支付给 coinbase 的小费，即
+// min(GasTipCap, GasFeeCap - baseFee)。 费用上限低于基础费用时结果为负数。 baseFee 为 nil 时返回 GasTipCap。
+func (tx *Transaction) EffectiveGasTip(baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.GasTipCap()
+	}
+	tip := new(big.Int).Sub(tx.data.Price, baseFee)
+	if tipCap := tx.GasTipCap(); tipCap.Cmp(tip) < 0 {
+		tip = tipCap
+	}
+	return tip
+}
+
+// EffectiveGasPrice 返回在给定基础费用下交易每单位gas实际支付的价格，即 baseFee + EffectiveGasTip。
+// baseFee 为 nil 时返回gas价格。
+func (tx *Transaction) EffectiveGasPrice(baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.GasPrice()
+	}
+	return new(big.Int).Add(baseFee, tx.EffectiveGasTip(baseFee))
+}
@@ -0,0 +1,158 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+var (
+	// ErrInvalidFeePayerSig 在代付账户的签名无效或与交易声明的代付账户不一致时返回。
+	ErrInvalidFeePayerSig = errors.New("无效的代付账户签名")
+
+	// errNoFeePayer 在对不是 FeePayerTxType 的交易查询代付账户时返回。
+	errNoFeePayer = errors.New("交易没有代付账户")
+)
+
+// feePayer 是代付gas交易中代付账户的地址及其签名。 签名的 V 只取 0 或 1，未签名时 V、R、S 均为 0。
+type feePayer struct {
+	Address chain_common.Address
+	V, R, S *big.Int
+}
+
+// unsigned 返回代付账户是否尚未签名。
+func (p *feePayer) unsigned() bool {
+	return p.V.Sign() == 0 && p.R.Sign() == 0 && p.S.Sign() == 0
+}
+
+// feePayerTxdata 是 FeePayerTxType 交易在类型字节之后的 RLP 内容。
+//
+// 发送者的签名覆盖除两个签名以外的全部字段，包括代付账户的地址，因此发送者指定了由谁代付；
+// 代付账户的签名还覆盖发送者的签名，因此它只为这一个发送者的这一笔交易付费。
+type feePayerTxdata struct {
+	ChainID      *big.Int
+	AccountNonce uint64
+	Price        *big.Int
+	GasLimit     uint64
+	Recipient    *chain_common.Address `rlp:"nil"`
+	Amount       *big.Int
+	Payload      []byte
+	FeePayer     chain_common.Address
+	V, R, S      *big.Int
+	FeePayerV    *big.Int
+	FeePayerR    *big.Int
+	FeePayerS    *big.Int
+}
+
+// NewFeePayerTransaction 创建一笔由 payer 代付gas的未签名交易。 to 为 nil 表示创建合约。
+//
+// 交易先由发送者签名（WithSignature），再由代付账户签名（WithFeePayerSignature）。 发送者支付转账金额，
+// 代付账户支付全部 gas 费用。
+func NewFeePayerTransaction(chainID *big.Int, nonce uint64, to *chain_common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, payer chain_common.Address) *Transaction {
+	tx := newTransaction(nonce, to, amount, gasLimit, gasPrice, data)
+	tx.typ = FeePayerTxType
+	tx.chainID = new(big.Int).Set(chainID)
+	tx.feePayer = &feePayer{Address: payer, V: new(big.Int), R: new(big.Int), S: new(big.Int)}
+	return tx
+}
+
+// FeePayerAddress 返回交易声明的代付账户，不是代付gas的交易返回 nil。 声明的账户只有在代付签名
+// 通过 FeePayer 校验之后才可信。
+func (tx *Transaction) FeePayerAddress() *chain_common.Address {
+	if tx.feePayer == nil {
+		return nil
+	}
+	addr := tx.feePayer.Address
+	return &addr
+}
+
+// RawFeePayerSignatureValues 返回代付账户的签名值，不是代付gas的交易返回 nil。
+func (tx *Transaction) RawFeePayerSignatureValues() (*big.Int, *big.Int, *big.Int) {
+	if tx.feePayer == nil {
+		return nil, nil, nil
+	}
+	return tx.feePayer.V, tx.feePayer.R, tx.feePayer.S
+}
+
+// WithFeePayerSignature 返回带有代付账户签名的新交易。 sig 是代付账户对 signer.FeePayerHash(tx) 的
+// 65 字节签名，交易必须已经由发送者签名。
+func (tx *Transaction) WithFeePayerSignature(signer TypedTxSigner, sig []byte) (*Transaction, error) {
+	if tx.typ != FeePayerTxType {
+		return nil, errNoFeePayer
+	}
+	r, s, v, err := signer.SignatureValues(tx, sig)
+	if err != nil {
+		return nil, err
+	}
+	cpy := &Transaction{typ: tx.typ, data: tx.data, chainID: tx.chainID}
+	cpy.feePayer = &feePayer{Address: tx.feePayer.Address, V: v, R: r, S: s}
+	return cpy, nil
+}
+
+// FeePayerHash 返回代付账户需要签名的哈希，它在发送者签名的内容之外还包括发送者的签名。
+func (s TypedTxSigner) FeePayerHash(tx *Transaction) chain_common.Hash {
+	return prefixedRlpHash(tx.typ, []interface{}{
+		s.chainId,
+		tx.data.AccountNonce,
+		tx.data.Price,
+		tx.data.GasLimit,
+		tx.data.Recipient,
+		tx.data.Amount,
+		tx.data.Payload,
+		tx.feePayer.Address,
+		tx.data.V,
+		tx.data.R,
+		tx.data.S,
+	})
+}
+
+// FeePayer 从代付签名中恢复代付账户，并检查它与交易声明的代付账户一致。
+func (s TypedTxSigner) FeePayer(tx *Transaction) (chain_common.Address, error) {
+	if tx.typ != FeePayerTxType {
+		return chain_common.Address{}, errNoFeePayer
+	}
+	if tx.ChainId().Cmp(s.chainId) != 0 {
+		return chain_common.Address{}, ErrInvalidChainId
+	}
+	payer := tx.feePayer
+	if payer.V.BitLen() > 1 {
+		return chain_common.Address{}, ErrInvalidFeePayerSig
+	}
+	// recoverPlain 期望黄皮书形式的 V（27 或 28）
+	V := new(big.Int).Add(payer.V, big.NewInt(27))
+	addr, err := recoverPlain(s.FeePayerHash(tx), payer.R, payer.S, V, true)
+	if err != nil || addr != payer.Address {
+		return chain_common.Address{}, ErrInvalidFeePayerSig
+	}
+	return addr, nil
+}
+
+// FeePayer 返回代付gas交易中经过签名校验的代付账户。 结果与发送者一样按签名者缓存在交易中。
+func FeePayer(signer Signer, tx *Transaction) (chain_common.Address, error) {
+	if sc := tx.payer.Load(); sc != nil {
+		cache := sc.(sigCache)
+		if cache.signer.Equal(signer) {
+			return cache.from, nil
+		}
+	}
+	typed, ok := signer.(TypedTxSigner)
+	if !ok {
+		return chain_common.Address{}, ErrTxTypeNotSupported
+	}
+	addr, err := typed.FeePayer(tx)
+	if err != nil {
+		return chain_common.Address{}, err
+	}
+	tx.payer.Store(sigCache{signer: signer, from: addr})
+	return addr, nil
+}
+
+// validFeePayerSignature 返回代付签名的值是否在有效范围内，尚未签名的代付交易也视为有效。
+func validFeePayerSignature(payer *feePayer) bool {
+	if payer.unsigned() {
+		return true
+	}
+	return payer.V.BitLen() <= 1 && crypto.ValidateSignatureValues(byte(payer.V.Uint64()), payer.R, payer.S, false)
+}
@@ -0,0 +1,56 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+func TestFeePayerSignature(t *testing.T) {
+	var (
+		chainID = big.NewInt(7)
+		signer  = NewTypedTxSigner(chainID)
+		keys    = newTestKeys(t, 3)
+		from    = crypto.PubkeyToAddress(keys[0].PublicKey)
+		payer   = crypto.PubkeyToAddress(keys[1].PublicKey)
+		to      = chain_common.Address{0x01}
+	)
+	unsigned := signTypedTx(t, signer, NewFeePayerTransaction(chainID, 0, &to, big.NewInt(1), 21000, big.NewInt(2), nil, payer), keys[0])
+
+	// 发送者签名不依赖代付签名，代付签名之前就可以恢复发送者
+	if sender, err := Sender(signer, unsigned); err != nil || sender != from {
+		t.Errorf("发送者不匹配: 得到 %x (%v), 需要 %x", sender, err, from)
+	}
+	if _, err := FeePayer(signer, unsigned); err != ErrInvalidFeePayerSig {
+		t.Errorf("缺少代付签名: 得到 %v, 需要 %v", err, ErrInvalidFeePayerSig)
+	}
+	// 代付账户签名之后两个账户都可以恢复，发送者不受代付签名影响
+	signed := signFeePayer(t, signer, unsigned, keys[1])
+	if sender, err := Sender(signer, signed); err != nil || sender != from {
+		t.Errorf("发送者不匹配: 得到 %x (%v), 需要 %x", sender, err, from)
+	}
+	if recovered, err := FeePayer(signer, signed); err != nil || recovered != payer {
+		t.Errorf("代付账户不匹配: 得到 %x (%v), 需要 %x", recovered, err, payer)
+	}
+	if signed.Cost().Cmp(big.NewInt(1)) != 0 || signed.FeePayerCost().Cmp(big.NewInt(21000*2)) != 0 {
+		t.Errorf("费用不匹配: 发送者 %v, 代付账户 %v", signed.Cost(), signed.FeePayerCost())
+	}
+	// 不是声明的代付账户签名的交易无效
+	if _, err := FeePayer(signer, signFeePayer(t, signer, unsigned, keys[2])); err != ErrInvalidFeePayerSig {
+		t.Errorf("其他账户的代付签名: 得到 %v, 需要 %v", err, ErrInvalidFeePayerSig)
+	}
+	// 其他链的签名者不接受交易
+	if _, err := FeePayer(NewTypedTxSigner(big.NewInt(8)), signed); err == nil {
+		t.Errorf("其他链的签名者接受了代付签名")
+	}
+	// 只能给代付gas的交易添加代付签名
+	legacy := signTypedTx(t, signer, NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(2), nil), keys[0])
+	if _, err := legacy.WithFeePayerSignature(signer, make([]byte, 65)); err != errNoFeePayer {
+		t.Errorf("旧式交易的代付签名: 得到 %v, 需要 %v", err, errNoFeePayer)
+	}
+	if _, err := FeePayer(signer, legacy); err != errNoFeePayer {
+		t.Errorf("旧式交易的代付账户: 得到 %v, 需要 %v", err, errNoFeePayer)
+	}
+}
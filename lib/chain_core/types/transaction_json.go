@@ -0,0 +1,364 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/hexutil"
+	"github.com/aidoc/go-aidoc/lib/i18"
+)
+
+var (
+	errUnknownField     = errors.New("未知字段")
+	errMissingField     = errors.New("缺少必需的字段")
+	errMissingSignature = errors.New("交易没有签名")
+	errFieldNotAllowed  = errors.New("该类型的交易不允许此字段")
+
+	// ErrUnprotectedTx 在要求了链 ID，交易却是没有重放保护的旧式交易时返回。
+	ErrUnprotectedTx = errors.New("交易没有重放保护")
+)
+
+// TxJSONError 是严格解码交易 JSON 时返回的错误，Field 是出错的字段名。
+type TxJSONError struct {
+	Field string
+	Err   error
+}
+
+func (e *TxJSONError) Error() string {
+	return i18.I18_print.Sprintf("交易 JSON 字段 '%s' 无效: %v", e.Field, e.Err)
+}
+
+// Unwrap 返回底层错误，例如 ErrInvalidChainId。
+func (e *TxJSONError) Unwrap() error {
+	return e.Err
+}
+
+// strictTxJSON 是 DecodeTransactionJSON 接受的全部字段。 from、blockHash、blockNumber 和
+// transactionIndex 是 RPC 返回交易时附带的字段，只用于校验，不属于交易本身。
+type strictTxJSON struct {
+	Type                 *hexutil.Uint64
+	ChainID              *hexutil.Big
+	Nonce                *hexutil.Uint64
+	GasPrice             *hexutil.Big
+	MaxPriorityFeePerGas *hexutil.Big
+	Gas                  *hexutil.Uint64
+	To                   *chain_common.Address
+	Value                *hexutil.Big
+	Input                *hexutil.Bytes
+	AccessList           *AccessList
+	FeePayer             *chain_common.Address
+	FeePayerV            *hexutil.Big
+	FeePayerR            *hexutil.Big
+	FeePayerS            *hexutil.Big
+	V, R, S              *hexutil.Big
+	Hash                 *chain_common.Hash
+
+	From             *chain_common.Address
+	BlockHash        *chain_common.Hash
+	BlockNumber      *hexutil.Big
+	TransactionIndex *hexutil.Uint64
+}
+
+// fields 返回 JSON 字段名到解码目标的映射。
+func (dec *strictTxJSON) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"type":                 &dec.Type,
+		"chainId":              &dec.ChainID,
+		"nonce":                &dec.Nonce,
+		"gasPrice":             &dec.GasPrice,
+		"maxPriorityFeePerGas": &dec.MaxPriorityFeePerGas,
+		"gas":                  &dec.Gas,
+		"to":                   &dec.To,
+		"value":                &dec.Value,
+		"input":                &dec.Input,
+		"accessList":           &dec.AccessList,
+		"feePayer":             &dec.FeePayer,
+		"feePayerV":            &dec.FeePayerV,
+		"feePayerR":            &dec.FeePayerR,
+		"feePayerS":            &dec.FeePayerS,
+		"v":                    &dec.V,
+		"r":                    &dec.R,
+		"s":                    &dec.S,
+		"hash":                 &dec.Hash,
+		"from":                 &dec.From,
+		"blockHash":            &dec.BlockHash,
+		"blockNumber":          &dec.BlockNumber,
+		"transactionIndex":     &dec.TransactionIndex,
+	}
+}
+
+// DecodeTransactionJSON 严格解码 MarshalJSON 格式（或 RPC 返回格式）的交易。 与 UnmarshalJSON 不同，它拒绝
+// 未知字段、缺少的必需字段、交易类型不允许的字段以及缺少的签名，代付gas的交易还必须带有与代付账户一致的
+// 代付签名；chainID 不为 nil 时，签名所属的链 ID 必须与它一致，没有重放保护的旧式交易被拒绝。 输入中带有
+// hash 或 from 时，它们必须与解码出的交易一致。 所有错误都是指明字段的 *TxJSONError。
+func DecodeTransactionJSON(input []byte, chainID *big.Int) (*Transaction, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(input, &raw); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dec := new(strictTxJSON)
+	fields := dec.fields()
+	for _, name := range names {
+		target, ok := fields[name]
+		if !ok {
+			return nil, &TxJSONError{Field: name, Err: errUnknownField}
+		}
+		if err := json.Unmarshal(raw[name], target); err != nil {
+			return nil, &TxJSONError{Field: name, Err: err}
+		}
+	}
+	tx, err := dec.transaction(chainID)
+	if err != nil {
+		return nil, err
+	}
+	if tx.typ == FeePayerTxType {
+		if _, err := FeePayer(deriveSigner(tx), tx); err != nil {
+			return nil, &TxJSONError{Field: "feePayerV", Err: err}
+		}
+	}
+	if dec.Hash != nil && *dec.Hash != tx.Hash() {
+		return nil, &TxJSONError{Field: "hash", Err: fmt.Errorf(i18.I18_print.Sprintf("与交易哈希 %x 不一致", tx.Hash()))}
+	}
+	if dec.From != nil {
+		from, err := Sender(deriveSigner(tx), tx)
+		if err != nil {
+			return nil, &TxJSONError{Field: "v", Err: err}
+		}
+		if from != *dec.From {
+			return nil, &TxJSONError{Field: "from", Err: fmt.Errorf(i18.I18_print.Sprintf("与签名恢复的发送者 %x 不一致", from))}
+		}
+	}
+	return tx, nil
+}
+
+// transaction 校验解码的字段并构造交易。
+func (dec *strictTxJSON) transaction(chainID *big.Int) (*Transaction, error) {
+	typ := uint8(LegacyTxType)
+	if dec.Type != nil {
+		if *dec.Type > FeePayerTxType {
+			return nil, &TxJSONError{Field: "type", Err: ErrTxTypeNotSupported}
+		}
+		typ = uint8(*dec.Type)
+	}
+	required := []struct {
+		name    string
+		missing bool
+	}{
+		{"nonce", dec.Nonce == nil},
+		{"gasPrice", dec.GasPrice == nil},
+		{"gas", dec.Gas == nil},
+		{"value", dec.Value == nil},
+		{"input", dec.Input == nil},
+		{"chainId", typ != LegacyTxType && dec.ChainID == nil},
+		{"maxPriorityFeePerGas", typ == DynamicFeeTxType && dec.MaxPriorityFeePerGas == nil},
+		{"feePayer", typ == FeePayerTxType && dec.FeePayer == nil},
+		{"feePayerV", typ == FeePayerTxType && dec.FeePayerV == nil},
+		{"feePayerR", typ == FeePayerTxType && dec.FeePayerR == nil},
+		{"feePayerS", typ == FeePayerTxType && dec.FeePayerS == nil},
+	}
+	for _, field := range required {
+		if field.missing {
+			return nil, &TxJSONError{Field: field.name, Err: errMissingField}
+		}
+	}
+	forbidden := []struct {
+		name    string
+		present bool
+	}{
+		{"accessList", dec.AccessList != nil && typ != AccessListTxType && typ != DynamicFeeTxType},
+		{"maxPriorityFeePerGas", dec.MaxPriorityFeePerGas != nil && typ != DynamicFeeTxType},
+		{"feePayer", dec.FeePayer != nil && typ != FeePayerTxType},
+		{"feePayerV", dec.FeePayerV != nil && typ != FeePayerTxType},
+		{"feePayerR", dec.FeePayerR != nil && typ != FeePayerTxType},
+		{"feePayerS", dec.FeePayerS != nil && typ != FeePayerTxType},
+	}
+	for _, field := range forbidden {
+		if field.present {
+			return nil, &TxJSONError{Field: field.name, Err: errFieldNotAllowed}
+		}
+	}
+	if dec.V == nil || dec.R == nil || dec.S == nil || ((*big.Int)(dec.R).Sign() == 0 && (*big.Int)(dec.S).Sign() == 0) {
+		return nil, &TxJSONError{Field: "v", Err: errMissingSignature}
+	}
+	tx := &Transaction{
+		typ: typ,
+		data: txdata{
+			AccountNonce: uint64(*dec.Nonce),
+			Price:        (*big.Int)(dec.GasPrice),
+			GasLimit:     uint64(*dec.Gas),
+			Recipient:    dec.To,
+			Amount:       (*big.Int)(dec.Value),
+			Payload:      *dec.Input,
+			V:            (*big.Int)(dec.V),
+			R:            (*big.Int)(dec.R),
+			S:            (*big.Int)(dec.S),
+		},
+	}
+	if err := tx.checkSignatureJSON(dec.ChainID, chainID); err != nil {
+		return nil, err
+	}
+	switch typ {
+	case AccessListTxType, DynamicFeeTxType:
+		if dec.AccessList != nil {
+			tx.accessList = *dec.AccessList
+		}
+		if typ == DynamicFeeTxType {
+			tx.tipCap = (*big.Int)(dec.MaxPriorityFeePerGas)
+		}
+	case FeePayerTxType:
+		payer := &feePayer{
+			Address: *dec.FeePayer,
+			V:       (*big.Int)(dec.FeePayerV),
+			R:       (*big.Int)(dec.FeePayerR),
+			S:       (*big.Int)(dec.FeePayerS),
+		}
+		// 严格解码不接受只有发送者签名的代付交易
+		if payer.unsigned() {
+			return nil, &TxJSONError{Field: "feePayerV", Err: errMissingSignature}
+		}
+		if !validFeePayerSignature(payer) {
+			return nil, &TxJSONError{Field: "feePayerV", Err: ErrInvalidFeePayerSig}
+		}
+		tx.feePayer = payer
+	}
+	return tx, nil
+}
+
+// checkSignatureJSON 检查签名值以及签名所属的链 ID。 declared 是 JSON 中的 chainId 字段，expected 是
+// 调用方要求的链 ID，两者都可以为 nil。
+func (tx *Transaction) checkSignatureJSON(declared *hexutil.Big, expected *big.Int) error {
+	V := tx.data.V
+	var (
+		recovery byte
+		signed   *big.Int // 签名所属的链 ID，未受重放保护的旧式交易为 nil
+	)
+	if tx.typ == LegacyTxType {
+		switch {
+		case V.BitLen() <= 8 && (V.Uint64() == 27 || V.Uint64() == 28):
+			recovery = byte(V.Uint64() - 27)
+		case isProtectedV(V):
+			signed = deriveChainId(V)
+			recovery = byte(new(big.Int).Sub(V, new(big.Int).Add(new(big.Int).Mul(signed, big.NewInt(2)), big.NewInt(35))).Uint64())
+		default:
+			return &TxJSONError{Field: "v", Err: ErrInvalidSig}
+		}
+		if declared != nil && (signed == nil || signed.Cmp((*big.Int)(declared)) != 0) {
+			return &TxJSONError{Field: "chainId", Err: fmt.Errorf(i18.I18_print.Sprintf("与 v 编码的链 ID %v 不一致", signed))}
+		}
+	} else {
+		if V.BitLen() > 1 {
+			return &TxJSONError{Field: "v", Err: ErrInvalidSig}
+		}
+		recovery = byte(V.Uint64())
+		signed = (*big.Int)(declared)
+		tx.chainID = signed
+	}
+	if expected != nil && signed == nil {
+		return &TxJSONError{Field: "v", Err: ErrUnprotectedTx}
+	}
+	if expected != nil && signed.Cmp(expected) != 0 {
+		field := "v"
+		if tx.typ != LegacyTxType {
+			field = "chainId"
+		}
+		return &TxJSONError{Field: field, Err: ErrInvalidChainId}
+	}
+	if !validSignatureScalar(tx.data.R) {
+		return &TxJSONError{Field: "r", Err: ErrInvalidSig}
+	}
+	if !validSignatureScalar(tx.data.S) {
+		return &TxJSONError{Field: "s", Err: ErrInvalidSig}
+	}
+	if !crypto.ValidateSignatureValues(recovery, tx.data.R, tx.data.S, false) {
+		return &TxJSONError{Field: "v", Err: ErrInvalidSig}
+	}
+	return nil
+}
+
+// validSignatureScalar 返回签名的 r 或 s 是否在 [1, secp256k1N) 范围内。
+func validSignatureScalar(x *big.Int) bool {
+	return crypto.ValidateSignatureValues(0, x, chain_common.Big1, false)
+}
+
+// txTypeNames 是交易类型在 Describe 输出中的名称。
+var txTypeNames = map[uint8]string{
+	LegacyTxType:     "legacy",
+	AccessListTxType: "access-list",
+	DynamicFeeTxType: "dynamic-fee",
+	FeePayerTxType:   "fee-payer",
+}
+
+// signerName 返回签名者的可读名称。
+func signerName(s Signer) string {
+	switch s := s.(type) {
+	case TypedTxSigner:
+		return i18.I18_print.Sprintf("TypedTxSigner (chainId %v)", s.chainId)
+	case EIP155Signer:
+		return i18.I18_print.Sprintf("EIP155Signer (chainId %v)", s.chainId)
+	case HomesteadSigner:
+		return "HomesteadSigner"
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// Describe 返回交易的可读描述：类型、解码出的签名者、发送者、接收者以及以 Aidoc 面额显示的金额和费用，
+// 供人工排查使用。 签名无效时在发送者一行显示错误。
+func (tx *Transaction) Describe() string {
+	var (
+		b      strings.Builder
+		signer = deriveSigner(tx)
+	)
+	line := func(label string, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "%-12s %s\n", label+":", i18.I18_print.Sprintf(format, args...))
+	}
+	line("hash", "%x", tx.Hash())
+	line("type", "%#x (%s)", tx.typ, txTypeNames[tx.typ])
+	line("signer", "%s", signerName(signer))
+
+	if from, err := Sender(signer, tx); err != nil {
+		line("from", "<%v>", err)
+	} else {
+		line("from", "%x", from)
+	}
+	if to := tx.To(); to != nil {
+		line("to", "%x", *to)
+	} else {
+		line("to", "<创建合约>")
+	}
+	if tx.typ == FeePayerTxType {
+		if payer, err := FeePayer(signer, tx); err != nil {
+			line("feePayer", "%x <%v>", tx.feePayer.Address, err)
+		} else {
+			line("feePayer", "%x", payer)
+		}
+	}
+	line("value", "%s (%v Dose)", configs.FormatAmount(tx.data.Amount), tx.data.Amount)
+	line("nonce", "%d", tx.data.AccountNonce)
+	line("gas", "%d", tx.data.GasLimit)
+
+	if tx.typ == DynamicFeeTxType {
+		line("maxFee", "%s", configs.FormatAmount(tx.data.Price))
+		line("maxTip", "%s", configs.FormatAmount(tx.tipCap))
+	} else {
+		line("gasPrice", "%s", configs.FormatAmount(tx.data.Price))
+	}
+	line("maxCost", "%s", configs.FormatAmount(tx.gasCost()))
+	line("input", "%d 字节", len(tx.data.Payload))
+	if len(tx.accessList) > 0 {
+		line("accessList", "%d 个账户, %d 个存储槽", len(tx.accessList), tx.accessList.StorageKeys())
+	}
+	return b.String()
+}
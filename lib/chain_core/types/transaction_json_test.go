@@ -0,0 +1,191 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+// modifyTxJSON 修改交易 JSON 编码中的字段，nil 表示删除字段。
+func modifyTxJSON(t *testing.T, enc []byte, changes map[string]interface{}) []byte {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(enc, &fields); err != nil {
+		t.Fatalf("无法解码 JSON: %v", err)
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(fields, name)
+		} else {
+			fields[name] = value
+		}
+	}
+	blob, _ := json.Marshal(fields)
+	return blob
+}
+
+// checkTxJSONError 检查 err 是指明 field 的 *TxJSONError，want 不为 nil 时还检查底层错误。
+func checkTxJSONError(t *testing.T, name string, err error, field string, want error) {
+	t.Helper()
+
+	var jsonErr *TxJSONError
+	if !errors.As(err, &jsonErr) {
+		t.Errorf("%s: 需要 *TxJSONError, 得到 %v", name, err)
+		return
+	}
+	if jsonErr.Field != field {
+		t.Errorf("%s: 字段不匹配: 得到 %q, 需要 %q", name, jsonErr.Field, field)
+	}
+	if want != nil && !errors.Is(err, want) {
+		t.Errorf("%s: 错误不匹配: 得到 %v, 需要 %v", name, err, want)
+	}
+}
+
+func TestDecodeTransactionJSON(t *testing.T) {
+	signer := NewEIP155Signer(big.NewInt(7))
+	tx := newSignedTransactions(t, signer, newTestKeys(t, 1), 1)[0]
+
+	enc, err := tx.MarshalJSON()
+	if err != nil {
+		t.Fatalf("无法编码交易: %v", err)
+	}
+	modify := func(changes map[string]interface{}) []byte {
+		return modifyTxJSON(t, enc, changes)
+	}
+	dec, err := DecodeTransactionJSON(enc, big.NewInt(7))
+	if err != nil {
+		t.Fatalf("无法解码有效的交易: %v", err)
+	}
+	if dec.Hash() != tx.Hash() {
+		t.Fatalf("哈希不匹配: 得到 %x, 需要 %x", dec.Hash(), tx.Hash())
+	}
+	tests := []struct {
+		input   []byte
+		chainID *big.Int
+		field   string
+		err     error
+	}{
+		{modify(map[string]interface{}{"gasLimit": "0x5208"}), nil, "gasLimit", errUnknownField},
+		{modify(map[string]interface{}{"gas": nil}), nil, "gas", errMissingField},
+		{modify(map[string]interface{}{"nonce": "12"}), nil, "nonce", nil},
+		{modify(map[string]interface{}{"r": "0x0", "s": "0x0"}), nil, "v", errMissingSignature},
+		{modify(map[string]interface{}{"v": nil}), nil, "v", errMissingSignature},
+		{enc, big.NewInt(8), "v", ErrInvalidChainId},
+		{modify(map[string]interface{}{"chainId": "0x8"}), nil, "chainId", nil},
+		{modify(map[string]interface{}{"accessList": []interface{}{}}), nil, "accessList", errFieldNotAllowed},
+		{modify(map[string]interface{}{"hash": "0x" + strings.Repeat("00", 32)}), nil, "hash", nil},
+	}
+	for i, test := range tests {
+		_, err := DecodeTransactionJSON(test.input, test.chainID)
+		checkTxJSONError(t, fmt.Sprintf("测试 %d", i), err, test.field, test.err)
+	}
+	// 要求链 ID 时拒绝没有重放保护的旧式交易，不要求时接受
+	unprotected := newSignedTransactions(t, HomesteadSigner{}, newTestKeys(t, 1), 1)[0]
+	if enc, err = unprotected.MarshalJSON(); err != nil {
+		t.Fatalf("无法编码交易: %v", err)
+	}
+	if _, err := DecodeTransactionJSON(enc, nil); err != nil {
+		t.Errorf("无法解码没有重放保护的交易: %v", err)
+	}
+	_, err = DecodeTransactionJSON(enc, big.NewInt(7))
+	checkTxJSONError(t, "没有重放保护", err, "v", ErrUnprotectedTx)
+}
+
+func TestDecodeTypedTransactionJSON(t *testing.T) {
+	var (
+		chainID = big.NewInt(7)
+		keys    = newTestKeys(t, 3)
+		txs     = newTypedTestTransactions(t, chainID, keys[0], keys[1])
+		encs    = make([][]byte, len(txs))
+	)
+	for i, tx := range txs {
+		enc, err := tx.MarshalJSON()
+		if err != nil {
+			t.Fatalf("无法编码交易: %v", err)
+		}
+		dec, err := DecodeTransactionJSON(enc, chainID)
+		if err != nil {
+			t.Fatalf("类型 %d: 无法解码有效的交易: %v", tx.Type(), err)
+		}
+		if dec.Hash() != tx.Hash() {
+			t.Errorf("类型 %d: 哈希不匹配: 得到 %x, 需要 %x", tx.Type(), dec.Hash(), tx.Hash())
+		}
+		encs[i] = enc
+	}
+	var (
+		accessListJSON = encs[AccessListTxType]
+		dynamicFeeJSON = encs[DynamicFeeTxType]
+		feePayerJSON   = encs[FeePayerTxType]
+		other          = fmt.Sprintf("0x%x", crypto.PubkeyToAddress(keys[2].PublicKey))
+	)
+	tests := []struct {
+		name    string
+		input   []byte
+		chainID *big.Int
+		field   string
+		err     error
+	}{
+		{"访问列表: 其他链", accessListJSON, big.NewInt(8), "chainId", ErrInvalidChainId},
+		{"访问列表: 缺少链 ID", modifyTxJSON(t, accessListJSON, map[string]interface{}{"chainId": nil}), nil, "chainId", errMissingField},
+		{"访问列表: 小费上限", modifyTxJSON(t, accessListJSON, map[string]interface{}{"maxPriorityFeePerGas": "0x1"}), nil, "maxPriorityFeePerGas", errFieldNotAllowed},
+		{"访问列表: 未知类型", modifyTxJSON(t, accessListJSON, map[string]interface{}{"type": "0x101"}), nil, "type", ErrTxTypeNotSupported},
+		{"动态费用: 缺少小费上限", modifyTxJSON(t, dynamicFeeJSON, map[string]interface{}{"maxPriorityFeePerGas": nil}), nil, "maxPriorityFeePerGas", errMissingField},
+		{"动态费用: 代付账户", modifyTxJSON(t, dynamicFeeJSON, map[string]interface{}{"feePayer": other}), nil, "feePayer", errFieldNotAllowed},
+		{"动态费用: 签名的 v", modifyTxJSON(t, dynamicFeeJSON, map[string]interface{}{"v": "0x25"}), nil, "v", ErrInvalidSig},
+		{"代付: 缺少代付账户", modifyTxJSON(t, feePayerJSON, map[string]interface{}{"feePayer": nil}), nil, "feePayer", errMissingField},
+		{"代付: 缺少代付签名", modifyTxJSON(t, feePayerJSON, map[string]interface{}{"feePayerV": nil}), nil, "feePayerV", errMissingField},
+		{"代付: 未签名", modifyTxJSON(t, feePayerJSON, map[string]interface{}{"feePayerV": "0x0", "feePayerR": "0x0", "feePayerS": "0x0"}), nil, "feePayerV", errMissingSignature},
+		{"代付: 其他代付账户", modifyTxJSON(t, feePayerJSON, map[string]interface{}{"feePayer": other}), nil, "feePayerV", ErrInvalidFeePayerSig},
+		{"代付: 访问列表", modifyTxJSON(t, feePayerJSON, map[string]interface{}{"accessList": []interface{}{}}), nil, "accessList", errFieldNotAllowed},
+	}
+	for _, test := range tests {
+		_, err := DecodeTransactionJSON(test.input, test.chainID)
+		checkTxJSONError(t, test.name, err, test.field, test.err)
+	}
+}
+
+func TestTransactionDescribe(t *testing.T) {
+	var (
+		chainID = big.NewInt(7)
+		keys    = newTestKeys(t, 2)
+		from    = fmt.Sprintf("%x", crypto.PubkeyToAddress(keys[0].PublicKey))
+		payer   = fmt.Sprintf("%x", crypto.PubkeyToAddress(keys[1].PublicKey))
+		txs     = newTypedTestTransactions(t, chainID, keys[0], keys[1])
+	)
+	tests := []struct {
+		tx      *Transaction
+		want    []string
+		notWant []string
+	}{
+		{txs[LegacyTxType], []string{"0x0 (legacy)", "EIP155Signer (chainId 7)", from, "gasPrice:"}, []string{"feePayer:", "maxTip:", "accessList:"}},
+		{txs[AccessListTxType], []string{"0x1 (access-list)", "TypedTxSigner (chainId 7)", from, "2 个账户, 2 个存储槽"}, []string{"feePayer:"}},
+		{txs[DynamicFeeTxType], []string{"0x2 (dynamic-fee)", from, "<创建合约>", "maxFee:", "maxTip:"}, []string{"gasPrice:"}},
+		{txs[FeePayerTxType], []string{"0x3 (fee-payer)", from, fmt.Sprintf("%-12s %s\n", "feePayer:", payer)}, []string{"maxTip:"}},
+	}
+	for _, test := range tests {
+		desc := test.tx.Describe()
+		if !strings.HasPrefix(desc, fmt.Sprintf("%-12s %x\n", "hash:", test.tx.Hash())) {
+			t.Errorf("类型 %d: 描述应以哈希开头:\n%s", test.tx.Type(), desc)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(desc, want) {
+				t.Errorf("类型 %d: 描述缺少 %q:\n%s", test.tx.Type(), want, desc)
+			}
+		}
+		for _, unwanted := range test.notWant {
+			if strings.Contains(desc, unwanted) {
+				t.Errorf("类型 %d: 描述不应包含 %q:\n%s", test.tx.Type(), unwanted, desc)
+			}
+		}
+	}
+	// 签名无效时在对应的行显示错误而不是账户
+	unsigned := NewFeePayerTransaction(chainID, 0, nil, big.NewInt(1), 21000, big.NewInt(1), nil, crypto.PubkeyToAddress(keys[1].PublicKey))
+	desc := signTypedTx(t, NewTypedTxSigner(chainID), unsigned, keys[0]).Describe()
+	if want := fmt.Sprintf("%-12s %s <%v>", "feePayer:", payer, ErrInvalidFeePayerSig); !strings.Contains(desc, want) {
+		t.Errorf("描述缺少 %q:\n%s", want, desc)
+	}
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"runtime"
+	"sync"
+)
+
+// RecoverSenders 在与 CPU 数量相同的工作协程上并行恢复 txs 中每笔交易的发送者（以及代付gas交易的
+// 代付账户），并填充交易的缓存，之后使用同一签名者调用 Sender 和 FeePayer 不再需要恢复签名。
+//
+// 返回的切片与 txs 一一对应，记录每笔交易恢复失败的错误；全部成功时返回 nil。
+func RecoverSenders(signer Signer, txs Transactions) []error {
+	if len(txs) == 0 {
+		return nil
+	}
+	workers := runtime.NumCPU()
+	if len(txs) < workers {
+		workers = len(txs)
+	}
+	var (
+		inputs = make(chan int, len(txs))
+		errs   = make([]error, len(txs))
+		pend   sync.WaitGroup
+	)
+	for i := range txs {
+		inputs <- i
+	}
+	close(inputs)
+
+	for w := 0; w < workers; w++ {
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+			for i := range inputs {
+				_, err := Sender(signer, txs[i])
+				if err == nil && txs[i].typ == FeePayerTxType {
+					_, err = FeePayer(signer, txs[i])
+				}
+				errs[i] = err
+			}
+		}()
+	}
+	pend.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return errs
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package types
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+)
+
+// newSignedTransactions 创建 n 笔由 keys 轮流签名的交易。
+func newSignedTransactions(t testing.TB, signer Signer, keys []*ecdsa.PrivateKey, n int) Transactions {
+	txs := make(Transactions, n)
+	for i := range txs {
+		tx := NewTransaction(uint64(i), chain_common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil)
+		sig, err := crypto.Sign(signer.Hash(tx).Bytes(), keys[i%len(keys)])
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		if txs[i], err = tx.WithSignature(signer, sig); err != nil {
+			t.Fatalf("无法设置签名: %v", err)
+		}
+	}
+	return txs
+}
+
+// withoutSenderCache 返回 txs 的副本，副本没有缓存的发送者。
+func withoutSenderCache(txs Transactions) Transactions {
+	fresh := make(Transactions, len(txs))
+	for i, tx := range txs {
+		fresh[i] = &Transaction{data: tx.data}
+	}
+	return fresh
+}
+
+func newTestKeys(t testing.TB, n int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatalf("无法生成密钥: %v", err)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+func TestRecoverSenders(t *testing.T) {
+	var (
+		signer = NewEIP155Signer(big.NewInt(1))
+		keys   = newTestKeys(t, 4)
+		txs    = newSignedTransactions(t, signer, keys, 100)
+	)
+	// 破坏一笔交易的签名，只有这一笔应当报告错误
+	txs = withoutSenderCache(txs)
+	txs[7].data.R = new(big.Int)
+
+	errs := RecoverSenders(signer, txs)
+	if len(errs) != len(txs) {
+		t.Fatalf("错误数量不匹配: 得到 %d, 需要 %d", len(errs), len(txs))
+	}
+	for i, tx := range txs {
+		if i == 7 {
+			if errs[i] == nil {
+				t.Errorf("交易 %d: 签名无效但没有报告错误", i)
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Fatalf("交易 %d: 恢复发送者失败: %v", i, errs[i])
+		}
+		if tx.from.Load() == nil {
+			t.Fatalf("交易 %d: 发送者没有缓存", i)
+		}
+		from, _ := Sender(signer, tx)
+		if want := crypto.PubkeyToAddress(keys[i%len(keys)].PublicKey); from != want {
+			t.Errorf("交易 %d: 发送者不匹配: 得到 %x, 需要 %x", i, from, want)
+		}
+	}
+	if errs := RecoverSenders(signer, txs[:7]); errs != nil {
+		t.Errorf("全部成功时应返回 nil, 得到 %v", errs)
+	}
+}
+
+func BenchmarkRecoverSendersSerial(b *testing.B) {
+	benchmarkRecoverSenders(b, func(signer Signer, txs Transactions) {
+		for _, tx := range txs {
+			Sender(signer, tx)
+		}
+	})
+}
+
+func BenchmarkRecoverSendersParallel(b *testing.B) {
+	benchmarkRecoverSenders(b, func(signer Signer, txs Transactions) {
+		RecoverSenders(signer, txs)
+	})
+}
+
+// benchmarkRecoverSenders 测量 recover 恢复一个满区块（1000 笔交易）发送者的耗时。
+func benchmarkRecoverSenders(b *testing.B, recover func(Signer, Transactions)) {
+	signer := NewEIP155Signer(big.NewInt(1))
+	txs := newSignedTransactions(b, signer, newTestKeys(b, 16), 1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		fresh := withoutSenderCache(txs)
+		b.StartTimer()
+
+		recover(signer, fresh)
+	}
+}
@@ -0,0 +1,490 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/aidoc/go-aidoc/configs"
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/hexutil"
+	"github.com/aidoc/go-aidoc/lib/rlp"
+)
+
+// 交易类型。 旧式交易直接编码为 RLP 列表，其他类型编码为类型字节加上 RLP 编码的交易内容。
+const (
+	LegacyTxType     = 0x00
+	AccessListTxType = 0x01
+	DynamicFeeTxType = 0x02
+	FeePayerTxType   = 0x03
+)
+
+var (
+	// ErrTxTypeNotSupported 在解码未知类型的交易时返回。
+	ErrTxTypeNotSupported = errors.New("不支持的交易类型")
+
+	// errEmptyTypedTx 在类型化交易的编码为空时返回。
+	errEmptyTypedTx = errors.New("类型化交易的编码为空")
+)
+
+// AccessTuple 是访问列表中的一项：一个账户以及交易将要访问的该账户的存储槽。
+type AccessTuple struct {
+	Address     chain_common.Address `json:"address"`
+	StorageKeys []chain_common.Hash  `json:"storageKeys"`
+}
+
+// AccessList 是交易声明将要访问的账户和存储槽，EVM 在执行前预先加载它们并按条目收取 gas。
+type AccessList []AccessTuple
+
+// StorageKeys 返回访问列表中存储槽的总数。
+func (al AccessList) StorageKeys() int {
+	sum := 0
+	for _, tuple := range al {
+		sum += len(tuple.StorageKeys)
+	}
+	return sum
+}
+
+// Gas 返回访问列表需要预先支付的 gas。
+func (al AccessList) Gas() uint64 {
+	return uint64(len(al))*configs.TxAccessListAddressGas + uint64(al.StorageKeys())*configs.TxAccessListStorageKeyGas
+}
+
+// accessListTxdata 是 AccessListTxType 交易在类型字节之后的 RLP 内容。 签名的 V 只取 0 或 1。
+type accessListTxdata struct {
+	ChainID      *big.Int
+	AccountNonce uint64
+	Price        *big.Int
+	GasLimit     uint64
+	Recipient    *chain_common.Address `rlp:"nil"`
+	Amount       *big.Int
+	Payload      []byte
+	AccessList   AccessList
+	V, R, S      *big.Int
+}
+
+// NewAccessListTransaction 创建一笔未签名的带访问列表的交易。 to 为 nil 表示创建合约。
+func NewAccessListTransaction(chainID *big.Int, nonce uint64, to *chain_common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, accessList AccessList) *Transaction {
+	tx := newTransaction(nonce, to, amount, gasLimit, gasPrice, data)
+	tx.typ = AccessListTxType
+	tx.chainID = new(big.Int).Set(chainID)
+	tx.accessList = copyAccessList(accessList)
+	return tx
+}
+
+func copyAccessList(al AccessList) AccessList {
+	if al == nil {
+		return nil
+	}
+	cpy := make(AccessList, len(al))
+	for i, tuple := range al {
+		cpy[i] = AccessTuple{Address: tuple.Address, StorageKeys: append([]chain_common.Hash(nil), tuple.StorageKeys...)}
+	}
+	return cpy
+}
+
+// Type 返回交易的类型。
+func (tx *Transaction) Type() uint8 {
+	return tx.typ
+}
+
+// AccessList 返回交易的访问列表，旧式交易返回 nil。
+func (tx *Transaction) AccessList() AccessList {
+	return copyAccessList(tx.accessList)
+}
+
+// AccessListGas 返回交易的访问列表需要预先支付的 gas。
+func (tx *Transaction) AccessListGas() uint64 {
+	return tx.accessList.Gas()
+}
+
+// typedPayload 返回类型化交易在类型字节之后需要 RLP 编码的内容。
+func (tx *Transaction) typedPayload() (interface{}, error) {
+	switch tx.typ {
+	case AccessListTxType:
+		return &accessListTxdata{
+			ChainID:      tx.chainID,
+			AccountNonce: tx.data.AccountNonce,
+			Price:        tx.data.Price,
+			GasLimit:     tx.data.GasLimit,
+			Recipient:    tx.data.Recipient,
+			Amount:       tx.data.Amount,
+			Payload:      tx.data.Payload,
+			AccessList:   tx.accessList,
+			V:            tx.data.V,
+			R:            tx.data.R,
+			S:            tx.data.S,
+		}, nil
+	case DynamicFeeTxType:
+		return &dynamicFeeTxdata{
+			ChainID:      tx.chainID,
+			AccountNonce: tx.data.AccountNonce,
+			GasTipCap:    tx.tipCap,
+			GasFeeCap:    tx.data.Price,
+			GasLimit:     tx.data.GasLimit,
+			Recipient:    tx.data.Recipient,
+			Amount:       tx.data.Amount,
+			Payload:      tx.data.Payload,
+			AccessList:   tx.accessList,
+			V:            tx.data.V,
+			R:            tx.data.R,
+			S:            tx.data.S,
+		}, nil
+	case FeePayerTxType:
+		return &feePayerTxdata{
+			ChainID:      tx.chainID,
+			AccountNonce: tx.data.AccountNonce,
+			Price:        tx.data.Price,
+			GasLimit:     tx.data.GasLimit,
+			Recipient:    tx.data.Recipient,
+			Amount:       tx.data.Amount,
+			Payload:      tx.data.Payload,
+			FeePayer:     tx.feePayer.Address,
+			V:            tx.data.V,
+			R:            tx.data.R,
+			S:            tx.data.S,
+			FeePayerV:    tx.feePayer.V,
+			FeePayerR:    tx.feePayer.R,
+			FeePayerS:    tx.feePayer.S,
+		}, nil
+	}
+	return nil, ErrTxTypeNotSupported
+}
+
+// MarshalBinary 返回交易的规范编码：旧式交易是 RLP 列表，类型化交易是类型字节加上 RLP 内容。
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	if tx.typ == LegacyTxType {
+		return rlp.EncodeToBytes(&tx.data)
+	}
+	payload, err := tx.typedPayload()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(tx.typ)
+	if err := rlp.Encode(&buf, payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary 解码 MarshalBinary 产生的规范编码。
+func (tx *Transaction) UnmarshalBinary(b []byte) error {
+	if len(b) > 0 && b[0] > 0x7f {
+		// RLP 列表，即旧式交易
+		var data txdata
+		if err := rlp.DecodeBytes(b, &data); err != nil {
+			return err
+		}
+		*tx = Transaction{data: data}
+		tx.size.Store(chain_common.StorageSize(len(b)))
+		return nil
+	}
+	dec, err := decodeTypedTx(b)
+	if err != nil {
+		return err
+	}
+	*tx = *dec
+	return nil
+}
+
+// decodeTypedTx 解码类型字节加上 RLP 内容形式的类型化交易。
+func decodeTypedTx(b []byte) (*Transaction, error) {
+	if len(b) == 0 {
+		return nil, errEmptyTypedTx
+	}
+	var tx *Transaction
+
+	switch b[0] {
+	case AccessListTxType:
+		var inner accessListTxdata
+		if err := rlp.DecodeBytes(b[1:], &inner); err != nil {
+			return nil, err
+		}
+		tx = &Transaction{
+			typ: AccessListTxType,
+			data: txdata{
+				AccountNonce: inner.AccountNonce,
+				Price:        inner.Price,
+				GasLimit:     inner.GasLimit,
+				Recipient:    inner.Recipient,
+				Amount:       inner.Amount,
+				Payload:      inner.Payload,
+				V:            inner.V,
+				R:            inner.R,
+				S:            inner.S,
+			},
+			chainID:    inner.ChainID,
+			accessList: inner.AccessList,
+		}
+	case DynamicFeeTxType:
+		var inner dynamicFeeTxdata
+		if err := rlp.DecodeBytes(b[1:], &inner); err != nil {
+			return nil, err
+		}
+		tx = &Transaction{
+			typ: DynamicFeeTxType,
+			data: txdata{
+				AccountNonce: inner.AccountNonce,
+				Price:        inner.GasFeeCap,
+				GasLimit:     inner.GasLimit,
+				Recipient:    inner.Recipient,
+				Amount:       inner.Amount,
+				Payload:      inner.Payload,
+				V:            inner.V,
+				R:            inner.R,
+				S:            inner.S,
+			},
+			chainID:    inner.ChainID,
+			accessList: inner.AccessList,
+			tipCap:     inner.GasTipCap,
+		}
+	case FeePayerTxType:
+		var inner feePayerTxdata
+		if err := rlp.DecodeBytes(b[1:], &inner); err != nil {
+			return nil, err
+		}
+		tx = &Transaction{
+			typ: FeePayerTxType,
+			data: txdata{
+				AccountNonce: inner.AccountNonce,
+				Price:        inner.Price,
+				GasLimit:     inner.GasLimit,
+				Recipient:    inner.Recipient,
+				Amount:       inner.Amount,
+				Payload:      inner.Payload,
+				V:            inner.V,
+				R:            inner.R,
+				S:            inner.S,
+			},
+			chainID: inner.ChainID,
+			feePayer: &feePayer{
+				Address: inner.FeePayer,
+				V:       inner.FeePayerV,
+				R:       inner.FeePayerR,
+				S:       inner.FeePayerS,
+			},
+		}
+	default:
+		return nil, ErrTxTypeNotSupported
+	}
+	tx.size.Store(chain_common.StorageSize(len(b)))
+	return tx, nil
+}
+
+// typedHash 返回类型化交易的哈希，即类型字节加上 RLP 内容的 Keccak256。
+func (tx *Transaction) typedHash() chain_common.Hash {
+	enc, err := tx.MarshalBinary()
+	if err != nil {
+		return chain_common.Hash{}
+	}
+	return crypto.Keccak256Hash(enc)
+}
+
+// prefixedRlpHash 返回类型字节加上 x 的 RLP 编码的 Keccak256，用作类型化交易的签名哈希。
+func prefixedRlpHash(prefix byte, x interface{}) chain_common.Hash {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	rlp.Encode(&buf, x)
+	return crypto.Keccak256Hash(buf.Bytes())
+}
+
+// TypedTxSigner 是同时支持旧式交易和类型化交易的签名者。 旧式交易按 EIP155 规则处理，类型化交易
+// 在签名哈希中包含类型字节和链 ID，签名的 V 只取 0 或 1。
+type TypedTxSigner struct {
+	EIP155Signer
+}
+
+// NewTypedTxSigner 创建给定链 ID 的类型化交易签名者。
+func NewTypedTxSigner(chainId *big.Int) TypedTxSigner {
+	return TypedTxSigner{NewEIP155Signer(chainId)}
+}
+
+// MakeTypedSigner 根据链配置和区块编号返回签名者：任一类型化交易分叉之后返回 TypedTxSigner，
+// 否则与 MakeSigner 相同。
+func MakeTypedSigner(config *configs.ChainConfig, blockNumber *big.Int) Signer {
+	if config.IsAccessList(blockNumber) || config.IsDynamicFee(blockNumber) || config.IsFeePayer(blockNumber) {
+		return NewTypedTxSigner(config.ChainID)
+	}
+	return MakeSigner(config, blockNumber)
+}
+
+func (s TypedTxSigner) Equal(s2 Signer) bool {
+	typed, ok := s2.(TypedTxSigner)
+	return ok && typed.chainId.Cmp(s.chainId) == 0
+}
+
+func (s TypedTxSigner) Sender(tx *Transaction) (chain_common.Address, error) {
+	if tx.typ == LegacyTxType {
+		return s.EIP155Signer.Sender(tx)
+	}
+	if tx.ChainId().Cmp(s.chainId) != 0 {
+		return chain_common.Address{}, ErrInvalidChainId
+	}
+	if tx.data.V.BitLen() > 1 {
+		return chain_common.Address{}, ErrInvalidSig
+	}
+	// recoverPlain 期望黄皮书形式的 V（27 或 28）
+	V := new(big.Int).Add(tx.data.V, big.NewInt(27))
+	return recoverPlain(s.Hash(tx), tx.data.R, tx.data.S, V, true)
+}
+
+// SignatureValues 返回签名值。 类型化交易的 V 是签名的恢复标识（0 或 1）。
+func (s TypedTxSigner) SignatureValues(tx *Transaction, sig []byte) (R, S, V *big.Int, err error) {
+	if tx.typ == LegacyTxType {
+		return s.EIP155Signer.SignatureValues(tx, sig)
+	}
+	if tx.ChainId().Sign() != 0 && tx.ChainId().Cmp(s.chainId) != 0 {
+		return nil, nil, nil, ErrInvalidChainId
+	}
+	if len(sig) != 65 {
+		return nil, nil, nil, ErrInvalidSig
+	}
+	R = new(big.Int).SetBytes(sig[:32])
+	S = new(big.Int).SetBytes(sig[32:64])
+	V = new(big.Int).SetBytes(sig[64:])
+	return R, S, V, nil
+}
+
+// Hash 返回签名者需要签名的哈希。
+func (s TypedTxSigner) Hash(tx *Transaction) chain_common.Hash {
+	switch tx.typ {
+	case AccessListTxType:
+		return prefixedRlpHash(tx.typ, []interface{}{
+			s.chainId,
+			tx.data.AccountNonce,
+			tx.data.Price,
+			tx.data.GasLimit,
+			tx.data.Recipient,
+			tx.data.Amount,
+			tx.data.Payload,
+			tx.accessList,
+		})
+	case DynamicFeeTxType:
+		return prefixedRlpHash(tx.typ, []interface{}{
+			s.chainId,
+			tx.data.AccountNonce,
+			tx.tipCap,
+			tx.data.Price,
+			tx.data.GasLimit,
+			tx.data.Recipient,
+			tx.data.Amount,
+			tx.data.Payload,
+			tx.accessList,
+		})
+	case FeePayerTxType:
+		return prefixedRlpHash(tx.typ, []interface{}{
+			s.chainId,
+			tx.data.AccountNonce,
+			tx.data.Price,
+			tx.data.GasLimit,
+			tx.data.Recipient,
+			tx.data.Amount,
+			tx.data.Payload,
+			tx.feePayer.Address,
+		})
+	}
+	return s.EIP155Signer.Hash(tx)
+}
+
+// typedTxJSON 是类型化交易在旧式交易 JSON 格式之外附加的字段。
+type typedTxJSON struct {
+	Type       *hexutil.Uint64 `json:"type,omitempty"`
+	ChainID    *hexutil.Big    `json:"chainId,omitempty"`
+	AccessList *AccessList     `json:"accessList,omitempty"`
+	GasTipCap  *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"` // 只用于 DynamicFeeTxType，费用上限即 gasPrice
+
+	// 只用于 FeePayerTxType
+	FeePayer  *chain_common.Address `json:"feePayer,omitempty"`
+	FeePayerV *hexutil.Big          `json:"feePayerV,omitempty"`
+	FeePayerR *hexutil.Big          `json:"feePayerR,omitempty"`
+	FeePayerS *hexutil.Big          `json:"feePayerS,omitempty"`
+}
+
+// marshalTypedJSON 在旧式交易的 JSON 编码 enc 中加入类型化交易的附加字段。
+func (tx *Transaction) marshalTypedJSON(enc []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(enc, &fields); err != nil {
+		return nil, err
+	}
+	typ := hexutil.Uint64(tx.typ)
+	typed := &typedTxJSON{
+		Type:       &typ,
+		ChainID:    (*hexutil.Big)(tx.chainID),
+		AccessList: &tx.accessList,
+		GasTipCap:  (*hexutil.Big)(tx.tipCap),
+	}
+	if tx.feePayer != nil {
+		typed.FeePayer = &tx.feePayer.Address
+		typed.FeePayerV = (*hexutil.Big)(tx.feePayer.V)
+		typed.FeePayerR = (*hexutil.Big)(tx.feePayer.R)
+		typed.FeePayerS = (*hexutil.Big)(tx.feePayer.S)
+	}
+	extra, err := json.Marshal(typed)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(extra, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// unmarshalTypedJSON 解码类型化交易的附加字段，dec 是已经解码的公共字段。 输入是旧式交易时返回 nil, nil。
+func unmarshalTypedJSON(input []byte, dec txdata) (*Transaction, error) {
+	var typed typedTxJSON
+	if err := json.Unmarshal(input, &typed); err != nil {
+		return nil, err
+	}
+	if typed.Type == nil || *typed.Type == LegacyTxType {
+		return nil, nil
+	}
+	if *typed.Type > FeePayerTxType {
+		return nil, ErrTxTypeNotSupported
+	}
+	tx := &Transaction{typ: uint8(*typed.Type), data: dec}
+
+	switch tx.typ {
+	case AccessListTxType:
+		if typed.AccessList != nil {
+			tx.accessList = *typed.AccessList
+		}
+	case DynamicFeeTxType:
+		if typed.AccessList != nil {
+			tx.accessList = *typed.AccessList
+		}
+		if typed.GasTipCap == nil {
+			return nil, errors.New("动态费用交易缺少 'maxPriorityFeePerGas'")
+		}
+		tx.tipCap = (*big.Int)(typed.GasTipCap)
+	case FeePayerTxType:
+		if typed.FeePayer == nil {
+			return nil, errors.New("代付gas交易缺少 'feePayer'")
+		}
+		if typed.FeePayerV == nil || typed.FeePayerR == nil || typed.FeePayerS == nil {
+			return nil, errors.New("代付gas交易缺少代付账户的签名")
+		}
+		tx.feePayer = &feePayer{
+			Address: *typed.FeePayer,
+			V:       (*big.Int)(typed.FeePayerV),
+			R:       (*big.Int)(typed.FeePayerR),
+			S:       (*big.Int)(typed.FeePayerS),
+		}
+	default:
+		return nil, ErrTxTypeNotSupported
+	}
+	if typed.ChainID == nil {
+		return nil, errors.New("类型化交易缺少 'chainId'")
+	}
+	tx.chainID = (*big.Int)(typed.ChainID)
+
+	if dec.V.BitLen() > 1 || !crypto.ValidateSignatureValues(byte(dec.V.Uint64()), dec.R, dec.S, false) {
+		return nil, ErrInvalidSig
+	}
+	if tx.feePayer != nil && !validFeePayerSignature(tx.feePayer) {
+		return nil, ErrInvalidFeePayerSig
+	}
+	return tx, nil
+}
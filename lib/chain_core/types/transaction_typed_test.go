@@ -0,0 +1,152 @@
+package types
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/rlp"
+)
+
+// signTypedTx 用 key 以 signer 签名交易。
+func signTypedTx(t testing.TB, signer Signer, tx *Transaction, key *ecdsa.PrivateKey) *Transaction {
+	sig, err := crypto.Sign(signer.Hash(tx).Bytes(), key)
+	if err != nil {
+		t.Fatalf("无法签名交易: %v", err)
+	}
+	signed, err := tx.WithSignature(signer, sig)
+	if err != nil {
+		t.Fatalf("无法设置签名: %v", err)
+	}
+	return signed
+}
+
+// signFeePayer 用代付账户的 key 为已经由发送者签名的交易添加代付签名。
+func signFeePayer(t testing.TB, signer TypedTxSigner, tx *Transaction, key *ecdsa.PrivateKey) *Transaction {
+	sig, err := crypto.Sign(signer.FeePayerHash(tx).Bytes(), key)
+	if err != nil {
+		t.Fatalf("无法签名代付交易: %v", err)
+	}
+	signed, err := tx.WithFeePayerSignature(signer, sig)
+	if err != nil {
+		t.Fatalf("无法设置代付签名: %v", err)
+	}
+	return signed
+}
+
+// newTypedTestTransactions 返回链 chainID 上每种类型各一笔已签名的交易，代付gas的交易由 payer 签名代付。
+func newTypedTestTransactions(t testing.TB, chainID *big.Int, key, payer *ecdsa.PrivateKey) []*Transaction {
+	var (
+		signer = NewTypedTxSigner(chainID)
+		to     = chain_common.Address{0x01}
+		list   = AccessList{
+			{Address: chain_common.Address{0x02}, StorageKeys: []chain_common.Hash{{0x01}, {0x02}}},
+			{Address: chain_common.Address{0x03}},
+		}
+	)
+	feePayer := signTypedTx(t, signer, NewFeePayerTransaction(chainID, 3, &to, big.NewInt(4), 21000, big.NewInt(5), []byte{0xfe}, crypto.PubkeyToAddress(payer.PublicKey)), key)
+
+	return []*Transaction{
+		signTypedTx(t, signer, NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(2), []byte{0xaa}), key),
+		signTypedTx(t, signer, NewAccessListTransaction(chainID, 1, &to, big.NewInt(2), 50000, big.NewInt(3), []byte{0xbb}, list), key),
+		signTypedTx(t, signer, NewDynamicFeeTransaction(chainID, 2, nil, big.NewInt(3), 60000, big.NewInt(1), big.NewInt(10), []byte{0xcc}, list), key),
+		signFeePayer(t, signer, feePayer, payer),
+	}
+}
+
+// checkTypedTx 检查解码的交易与原交易一致，并且可以恢复发送者和代付账户。
+func checkTypedTx(t *testing.T, signer TypedTxSigner, want, got *Transaction, from, payer chain_common.Address) {
+	t.Helper()
+
+	if got.Hash() != want.Hash() || got.Type() != want.Type() {
+		t.Errorf("类型 %d: 交易不匹配: 得到 (%d, %x), 需要 (%d, %x)", want.Type(), got.Type(), got.Hash(), want.Type(), want.Hash())
+	}
+	if !reflect.DeepEqual(got.AccessList(), want.AccessList()) {
+		t.Errorf("类型 %d: 访问列表不匹配: 得到 %v, 需要 %v", want.Type(), got.AccessList(), want.AccessList())
+	}
+	if got.GasTipCap().Cmp(want.GasTipCap()) != 0 || got.GasFeeCap().Cmp(want.GasFeeCap()) != 0 {
+		t.Errorf("类型 %d: 费用不匹配: 得到 (%v, %v), 需要 (%v, %v)", want.Type(), got.GasTipCap(), got.GasFeeCap(), want.GasTipCap(), want.GasFeeCap())
+	}
+	if sender, err := Sender(signer, got); err != nil || sender != from {
+		t.Errorf("类型 %d: 发送者不匹配: 得到 %x (%v), 需要 %x", want.Type(), sender, err, from)
+	}
+	if want.Type() == FeePayerTxType {
+		if recovered, err := FeePayer(signer, got); err != nil || recovered != payer {
+			t.Errorf("代付账户不匹配: 得到 %x (%v), 需要 %x", recovered, err, payer)
+		}
+	}
+}
+
+func TestTypedTxRLPRoundTrip(t *testing.T) {
+	var (
+		chainID = big.NewInt(7)
+		signer  = NewTypedTxSigner(chainID)
+		keys    = newTestKeys(t, 2)
+		from    = crypto.PubkeyToAddress(keys[0].PublicKey)
+		payer   = crypto.PubkeyToAddress(keys[1].PublicKey)
+	)
+	for _, tx := range newTypedTestTransactions(t, chainID, keys[0], keys[1]) {
+		// 区块体中的 RLP 编码
+		blob, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatalf("类型 %d: 无法编码: %v", tx.Type(), err)
+		}
+		dec := new(Transaction)
+		if err := rlp.DecodeBytes(blob, dec); err != nil {
+			t.Fatalf("类型 %d: 无法解码: %v", tx.Type(), err)
+		}
+		checkTypedTx(t, signer, tx, dec, from, payer)
+
+		// 网络和 RPC 使用的二进制编码
+		if blob, err = tx.MarshalBinary(); err != nil {
+			t.Fatalf("类型 %d: 无法编码二进制: %v", tx.Type(), err)
+		}
+		dec = new(Transaction)
+		if err := dec.UnmarshalBinary(blob); err != nil {
+			t.Fatalf("类型 %d: 无法解码二进制: %v", tx.Type(), err)
+		}
+		checkTypedTx(t, signer, tx, dec, from, payer)
+	}
+}
+
+func TestTypedTxJSONRoundTrip(t *testing.T) {
+	var (
+		chainID = big.NewInt(7)
+		signer  = NewTypedTxSigner(chainID)
+		keys    = newTestKeys(t, 2)
+		from    = crypto.PubkeyToAddress(keys[0].PublicKey)
+		payer   = crypto.PubkeyToAddress(keys[1].PublicKey)
+	)
+	for _, tx := range newTypedTestTransactions(t, chainID, keys[0], keys[1]) {
+		enc, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatalf("类型 %d: 无法编码 JSON: %v", tx.Type(), err)
+		}
+		dec := new(Transaction)
+		if err := json.Unmarshal(enc, dec); err != nil {
+			t.Fatalf("类型 %d: 无法解码 JSON: %v", tx.Type(), err)
+		}
+		checkTypedTx(t, signer, tx, dec, from, payer)
+
+		if tx.Type() == LegacyTxType {
+			continue
+		}
+		// 超出已知范围的类型必须被拒绝，而不是截断为一个字节
+		for _, typ := range []string{"0x4", "0x7f", "0x101", "0x103"} {
+			var fields map[string]interface{}
+			if err := json.Unmarshal(enc, &fields); err != nil {
+				t.Fatalf("无法解码 JSON: %v", err)
+			}
+			fields["type"] = typ
+			blob, _ := json.Marshal(fields)
+
+			if err := json.Unmarshal(blob, new(Transaction)); err != ErrTxTypeNotSupported {
+				t.Errorf("类型 %s: 得到 %v, 需要 %v", typ, err, ErrTxTypeNotSupported)
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aidoc/go-aidoc/lib/chain_core"
+	"github.com/aidoc/go-aidoc/lib/logger"
+	"github.com/aidoc/go-aidoc/lib/rlp"
+	"github.com/aidoc/go-aidoc/main/utils"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	headerFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "导出格式：rlp（连续的 RLP 编码）或 json（每行一个 JSON 区块头）",
+		Value: "rlp",
+	}
+
+	headerCacheFlag = cli.IntFlag{
+		Name:  "cache.headers",
+		Usage: "区块头链缓存的区块头数量（0 = 默认值）",
+	}
+	tdCacheFlag = cli.IntFlag{
+		Name:  "cache.tds",
+		Usage: "区块头链缓存的总难度数量（0 = 默认值）",
+	}
+	numberCacheFlag = cli.IntFlag{
+		Name:  "cache.numbers",
+		Usage: "区块头链缓存的哈希到编号映射数量（0 = 默认值）",
+	}
+	baseFeeCacheFlag = cli.IntFlag{
+		Name:  "cache.basefees",
+		Usage: "区块头链缓存的区块基础费用数量（0 = 默认值）",
+	}
+
+	// headerCacheFlags 是控制区块头链缓存容量的标志。
+	headerCacheFlags = []cli.Flag{
+		headerCacheFlag,
+		tdCacheFlag,
+		numberCacheFlag,
+		baseFeeCacheFlag,
+	}
+
+	setHeadDryRunFlag = cli.BoolFlag{
+		Name:  "dryrun",
+		Usage: "只报告将被删除的数据量，不修改数据库",
+	}
+	setHeadRollbackFlag = cli.BoolFlag{
+		Name:  "rollback",
+		Usage: "撤销上一次被中断的回卷，而不是完成它",
+	}
+
+	setHeadCommand = cli.Command{
+		Action:    utils.MigrateFlags(setHead),
+		Name:      "set-head",
+		Usage:     "将本地链回卷到给定高度",
+		ArgsUsage: "[<blockNum>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			setHeadDryRunFlag,
+			setHeadRollbackFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+删除给定高度以上的所有区块头、总难度、规范哈希映射和区块体，不能回卷到最新检查点以下。
+使用 --dryrun 只报告将被删除的数据量而不修改数据库。 如果上一次回卷被中断，命令会先完成它；
+只需要完成中断的回卷时可以省略 blockNum。 使用 --rollback 撤销中断的回卷，恢复已经删除的区块头、
+总难度和规范哈希，已经删除的区块体不会恢复。`,
+	}
+
+	exportHeadersCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportHeaders),
+		Name:      "export-headers",
+		Usage:     "将规范区块头导出到文件",
+		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
+		Flags: append([]cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			headerFormatFlag,
+		}, headerCacheFlags...),
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+按编号顺序导出两个高度之间（包含两端）的规范区块头。 如果 blockNumFirst 大于 blockNumLast，
+则按编号降序导出。 省略范围时导出从创世区块到当前链头的所有区块头。 文件名为 "-" 时写入标准输出。`,
+	}
+)
+
+// setHead 报告或执行一次回卷，并先完成或撤销上一次被中断的回卷。
+func setHead(ctx *cli.Context) error {
+	if len(ctx.Args()) > 1 {
+		utils.Fatalf("用法: %s", ctx.Command.ArgsUsage)
+	}
+	dryRun := ctx.Bool(setHeadDryRunFlag.Name)
+
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	hc, err := chain_core.NewHeaderChain(chainDb, chain.Config(), chain.Engine(), func() bool { return false })
+	if err != nil {
+		utils.Fatalf("无法打开区块头链: %v", err)
+	}
+	if report := hc.PendingSetHead(); report != nil {
+		printSetHeadReport("未完成的回卷", report)
+		switch {
+		case dryRun:
+		case ctx.Bool(setHeadRollbackFlag.Name):
+			if err := hc.RollbackSetHead(); err != nil {
+				utils.Fatalf("无法撤销中断的回卷: %v", err)
+			}
+			logger.Info("已撤销中断的回卷", "head", hc.CurrentHeader().Number)
+			return nil
+		default:
+			if err := chain.SetHead(report.Target); err != nil {
+				utils.Fatalf("无法完成中断的回卷: %v", err)
+			}
+		}
+	}
+	if len(ctx.Args()) == 0 {
+		return nil
+	}
+	number, err := strconv.ParseUint(ctx.Args().First(), 10, 64)
+	if err != nil {
+		utils.Fatalf("无效的区块编号: %v", err)
+	}
+	report, err := hc.SetHeadDryRun(number)
+	if err != nil {
+		utils.Fatalf("无法回卷: %v", err)
+	}
+	printSetHeadReport("回卷", report)
+	if dryRun {
+		return nil
+	}
+	if err := chain.SetHead(number); err != nil {
+		utils.Fatalf("无法回卷: %v", err)
+	}
+	logger.Info("已回卷本地链", "number", chain.CurrentHeader().Number)
+	return nil
+}
+
+// printSetHeadReport 打印一次回卷将会删除的数据量。
+func printSetHeadReport(title string, report *chain_core.SetHeadReport) {
+	fmt.Printf("%s到 #%d: %d 个区块头, %d 个总难度, %d 个规范哈希\n", title, report.Target, report.Headers, report.Tds, report.CanonicalHashes)
+}
+
+// exportHeaders 将规范区块头以 RLP 或 JSON 行的形式写入文件。
+func exportHeaders(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 && len(ctx.Args()) != 3 {
+		utils.Fatalf("用法: %s", ctx.Command.ArgsUsage)
+	}
+	format := ctx.String(headerFormatFlag.Name)
+	if format != "rlp" && format != "json" {
+		utils.Fatalf("未知的导出格式: %s", format)
+	}
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	hc, err := chain_core.NewHeaderChainWithCache(chainDb, chain.Config(), makeHeaderCacheConfig(ctx), chain.Engine(), func() bool { return false })
+	if err != nil {
+		utils.Fatalf("无法打开区块头链: %v", err)
+	}
+	first, last := uint64(0), hc.CurrentHeader().Number.Uint64()
+	if len(ctx.Args()) == 3 {
+		if first, err = strconv.ParseUint(ctx.Args().Get(1), 10, 64); err != nil {
+			utils.Fatalf("无效的起始区块编号: %v", err)
+		}
+		if last, err = strconv.ParseUint(ctx.Args().Get(2), 10, 64); err != nil {
+			utils.Fatalf("无效的结束区块编号: %v", err)
+		}
+	}
+	var out io.Writer = os.Stdout
+	if fn := ctx.Args().First(); fn != "-" {
+		fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+		if err != nil {
+			utils.Fatalf("无法创建导出文件: %v", err)
+		}
+		defer fh.Close()
+		out = fh
+	}
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+
+	var (
+		start = time.Now()
+		enc   = json.NewEncoder(writer)
+		count int
+	)
+	it := hc.HeaderRange(first, last)
+	for it.Next() {
+		if format == "json" {
+			err = enc.Encode(it.Header())
+		} else {
+			err = rlp.Encode(writer, it.Header())
+		}
+		if err != nil {
+			utils.Fatalf("导出失败: %v", err)
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		utils.Fatalf("导出中断: %v", err)
+	}
+	logger.Info("已导出区块头", "count", count, "first", first, "last", last, "elapsed", time.Since(start))
+	return nil
+}
+
+// makeHeaderCacheConfig 根据命令行标志创建区块头链缓存配置，未设置的标志使用默认容量。
+func makeHeaderCacheConfig(ctx *cli.Context) *chain_core.HeaderCacheConfig {
+	return &chain_core.HeaderCacheConfig{
+		HeaderCache:  ctx.Int(headerCacheFlag.Name),
+		TdCache:      ctx.Int(tdCacheFlag.Name),
+		NumberCache:  ctx.Int(numberCacheFlag.Name),
+		BaseFeeCache: ctx.Int(baseFeeCacheFlag.Name),
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_core"
+	"gopkg.in/urfave/cli.v1"
+)
+
+func TestMakeHeaderCacheConfig(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range headerCacheFlags {
+		f.Apply(set)
+	}
+	if err := set.Parse([]string{"--cache.headers", "64", "--cache.basefees", "8"}); err != nil {
+		t.Fatalf("无法解析标志: %v", err)
+	}
+	config := makeHeaderCacheConfig(cli.NewContext(app, set, nil))
+
+	want := &chain_core.HeaderCacheConfig{HeaderCache: 64, BaseFeeCache: 8}
+	if !reflect.DeepEqual(config, want) {
+		t.Fatalf("缓存配置不匹配: 得到 %+v, 需要 %+v", config, want)
+	}
+}
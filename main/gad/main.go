@@ -24,6 +24,7 @@ import (
 	"gopkg.in/urfave/cli.v1"
 	"github.com/aidoc/go-aidoc/lib/logger"
 	"github.com/aidoc/go-aidoc/lib/i18"
+	"github.com/aidoc/go-aidoc/lib/chain_core"
 	"fmt"
 )
 
@@ -36,6 +37,11 @@ var (
 	gitCommit = ""
 	// 包含所有命令和标志的应用程序。
 	app = utils.NewApp(gitCommit, "go-aidoc 命令行接口")
+
+	txParallelFlag = cli.IntFlag{
+		Name:  "txparallel",
+		Usage: "推测并行执行区块交易的工作协程数量（<= 1 = 串行执行）",
+	}
 )
 
 func init() {
@@ -43,14 +49,15 @@ func init() {
 	app.Action = gad
 	app.HideVersion = true //  我们有一个命令打印版本
 	app.Copyright = "Copyright 2018 The go-aidoc Authors"
-	app.Commands = cliCommand
+	// 复制 cliCommand，避免追加时写入它的底层数组
+	app.Commands = append(append([]cli.Command{}, cliCommand...), exportHeadersCommand, setHeadCommand, traceBlocksCommand, describeTxCommand)
 	sort.Sort(cli.CommandsByName(app.Commands))
 
 	app.Flags = append(app.Flags, nodeFlags...)
 	app.Flags = append(app.Flags, rpcFlags...)
 	app.Flags = append(app.Flags, consoleFlags...)
 	app.Flags = append(app.Flags, debug.Flags...)
-	app.Flags = append(app.Flags, i18Flag)
+	app.Flags = append(app.Flags, i18Flag, txParallelFlag)
 
 	app.Before = func(ctx *cli.Context) error {
 		runtime.GOMAXPROCS(runtime.NumCPU())
@@ -114,6 +121,7 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 
 	// 启动节点本身
 	utils.StartNode(stack)
+	setTxParallelism(ctx, stack)
 
 	// 解锁特别要求的任何账户
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
@@ -193,3 +201,24 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 		}
 	}
 }
+
+// setTxParallelism 为全节点的区块链换上按 --txparallel 推测并行执行交易的状态处理器。 轻客户端不执行交易，
+// 标志被忽略。
+func setTxParallelism(ctx *cli.Context, stack *node.Node) {
+	workers := ctx.GlobalInt(txParallelFlag.Name)
+	if workers <= 1 {
+		return
+	}
+	var aidoc *service.Aidoc
+	if err := stack.Service(&aidoc); err != nil {
+		logger.Warn("Aidoc 服务未运行，忽略并行执行交易的设置", "txparallel", workers)
+		return
+	}
+	chain := aidoc.BlockChain()
+
+	processor := chain_core.NewStateProcessor(chain.Config(), chain, chain.Engine())
+	processor.SetParallelism(workers)
+	chain.SetProcessor(processor)
+
+	logger.Info("推测并行执行区块交易", "workers", workers)
+}
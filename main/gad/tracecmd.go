@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aidoc/go-aidoc/lib/chain_core"
+	"github.com/aidoc/go-aidoc/lib/chain_core/vm"
+	"github.com/aidoc/go-aidoc/lib/logger"
+	"github.com/aidoc/go-aidoc/main/utils"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var traceBlocksCommand = cli.Command{
+	Action:    utils.MigrateFlags(traceBlocks),
+	Name:      "trace-blocks",
+	Usage:     "重新执行一段规范区块并以 JSON 导出每个账户的状态变化",
+	ArgsUsage: "<filename> <blockNumFirst> <blockNumLast>",
+	Flags: []cli.Flag{
+		utils.DataDirFlag,
+		utils.CacheFlag,
+		utils.SyncModeFlag,
+	},
+	Category: "BLOCKCHAIN COMMANDS",
+	Description: `
+在父区块状态上重新执行两个高度之间（包含两端）的规范区块，不修改数据库。 输出一个 JSON 对象：
+blocks 包含每笔交易和奖励步骤前后的余额、nonce、存储和日志，ledger 按账户列出每次余额变化。
+文件名为 "-" 时写入标准输出。 父区块的状态必须仍然可用。`,
+}
+
+// traceBlocks 跟踪一段规范区块并把收集的结果写入文件。
+func traceBlocks(ctx *cli.Context) error {
+	if len(ctx.Args()) != 3 {
+		utils.Fatalf("用法: %s", ctx.Command.ArgsUsage)
+	}
+	first, err := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+	if err != nil {
+		utils.Fatalf("无效的起始区块编号: %v", err)
+	}
+	last, err := strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+	if err != nil {
+		utils.Fatalf("无效的结束区块编号: %v", err)
+	}
+	if first == 0 || first > last {
+		utils.Fatalf("无效的区块范围: %d - %d", first, last)
+	}
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	var (
+		start     = time.Now()
+		processor = chain_core.NewStateProcessor(chain.Config(), chain, chain.Engine())
+		collector = chain_core.NewBlockRangeCollector()
+	)
+	if err := processor.TraceRange(first, last, collector, vm.Config{}); err != nil {
+		utils.Fatalf("跟踪失败: %v", err)
+	}
+	var out io.Writer = os.Stdout
+	if fn := ctx.Args().First(); fn != "-" {
+		fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+		if err != nil {
+			utils.Fatalf("无法创建输出文件: %v", err)
+		}
+		defer fh.Close()
+		out = fh
+	}
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+
+	if err := collector.WriteJSON(writer); err != nil {
+		utils.Fatalf("写入失败: %v", err)
+	}
+	logger.Info("已跟踪区块", "first", first, "last", last, "elapsed", time.Since(start))
+	return nil
+}
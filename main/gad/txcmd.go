@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/hexutil"
+	"github.com/aidoc/go-aidoc/main/utils"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	txChainIdFlag = cli.Uint64Flag{
+		Name:  "chainid",
+		Usage: "要求交易签名属于该链 ID 并受重放保护（0 = 不检查）",
+	}
+
+	describeTxCommand = cli.Command{
+		Action:    utils.MigrateFlags(describeTx),
+		Name:      "describe-tx",
+		Usage:     "严格解码一笔交易并以可读形式显示",
+		ArgsUsage: "<filename>",
+		Flags: []cli.Flag{
+			txChainIdFlag,
+		},
+		Category: "MISCELLANEOUS COMMANDS",
+		Description: `
+从文件（文件名为 "-" 时从标准输入）读取一笔交易并显示类型、签名者、发送者、接收者以及以 Aidoc 面额
+表示的金额和费用。 输入可以是交易的 JSON（与 RPC 返回的格式相同），也可以是 0x 开头的规范二进制编码。
+JSON 按严格规则解码：未知字段、缺少的字段或签名以及不匹配的链 ID 都会报告出错的字段。 给定 --chainid 时
+没有重放保护的旧式交易也被拒绝。`,
+	}
+)
+
+// describeTx 严格解码一笔交易并打印它的可读描述。
+func describeTx(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("用法: %s", ctx.Command.ArgsUsage)
+	}
+	var (
+		input []byte
+		err   error
+	)
+	if fn := ctx.Args().First(); fn == "-" {
+		input, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		input, err = ioutil.ReadFile(fn)
+	}
+	if err != nil {
+		utils.Fatalf("无法读取交易: %v", err)
+	}
+	var chainID *big.Int
+	if id := ctx.Uint64(txChainIdFlag.Name); id != 0 {
+		chainID = new(big.Int).SetUint64(id)
+	}
+	tx, err := decodeTxInput(bytes.TrimSpace(input), chainID)
+	if err != nil {
+		utils.Fatalf("无效的交易: %v", err)
+	}
+	fmt.Print(tx.Describe())
+	return nil
+}
+
+// decodeTxInput 解码 JSON 或十六进制二进制编码的交易。 二进制编码没有字段名，只检查链 ID：给定 chainID 时
+// 拒绝没有重放保护的旧式交易和其他链的交易。
+func decodeTxInput(input []byte, chainID *big.Int) (*types.Transaction, error) {
+	if len(input) > 0 && input[0] == '{' {
+		return types.DecodeTransactionJSON(input, chainID)
+	}
+	blob, err := hexutil.Decode(string(input))
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(blob); err != nil {
+		return nil, err
+	}
+	if chainID != nil {
+		if !tx.Protected() {
+			return nil, types.ErrUnprotectedTx
+		}
+		if tx.ChainId().Cmp(chainID) != 0 {
+			return nil, types.ErrInvalidChainId
+		}
+	}
+	return tx, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/aidoc/go-aidoc/lib/chain_common"
+	"github.com/aidoc/go-aidoc/lib/chain_core/types"
+	"github.com/aidoc/go-aidoc/lib/crypto"
+	"github.com/aidoc/go-aidoc/lib/hexutil"
+)
+
+func TestDecodeTxInputChainID(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	encode := func(signer types.Signer) []byte {
+		tx, err := types.SignTx(types.NewTransaction(0, chain_common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			t.Fatalf("无法签名交易: %v", err)
+		}
+		blob, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatalf("无法编码交易: %v", err)
+		}
+		return []byte(hexutil.Encode(blob))
+	}
+	var (
+		protected   = encode(types.NewEIP155Signer(big.NewInt(7)))
+		unprotected = encode(types.HomesteadSigner{})
+	)
+	tests := []struct {
+		input   []byte
+		chainID *big.Int
+		err     error
+	}{
+		{protected, nil, nil},
+		{protected, big.NewInt(7), nil},
+		{protected, big.NewInt(8), types.ErrInvalidChainId},
+		{unprotected, nil, nil},
+		{unprotected, big.NewInt(7), types.ErrUnprotectedTx},
+	}
+	for i, test := range tests {
+		if _, err := decodeTxInput(test.input, test.chainID); err != test.err {
+			t.Errorf("测试 %d: 错误不匹配: 得到 %v, 需要 %v", i, err, test.err)
+		}
+	}
+}